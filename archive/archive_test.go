@@ -0,0 +1,131 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+func testBlock(num uint64) *block.Block {
+	return &block.Block{
+		Block: &common.Block{
+			Header:   &common.BlockHeader{Number: num, DataHash: []byte{byte(num)}},
+			Data:     &common.BlockData{},
+			Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {}, {}, {}}},
+		},
+		Num: num,
+	}
+}
+
+func Test_WriterReader(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w, err := NewWriter(nil, store, WithSegmentSize(64))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(0); i < 20; i++ {
+		if err := w.Handle(testBlock(i)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// resume skips archived blocks
+	w, _ = NewWriter(nil, store)
+	if last, ok := w.LastBlock(); !ok || last != 19 {
+		t.Errorf("expected last block 19, got %d", last)
+	}
+	w.Handle(testBlock(19))
+	w.Handle(testBlock(20))
+	w.Flush()
+
+	r := NewReader(store)
+	m, _ := r.Manifest()
+	if len(m.Segments) < 3 {
+		t.Errorf("expected rotated segments, got %d", len(m.Segments))
+	}
+	if h, err := r.Height(); err != nil || h != 21 {
+		t.Errorf("expected height 21, got %d, %v", h, err)
+	}
+	nums := []uint64{}
+	err = r.Replay(5, All, block.HandlerFunc(func(b *block.Block) error {
+		nums = append(nums, b.Num)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nums) != 16 || nums[0] != 5 || nums[15] != 20 {
+		t.Errorf("unexpected blocks: %v", nums)
+	}
+}
+
+func Test_File(t *testing.T) {
+	path := t.TempDir() + "/blocks.arc"
+	w, err := NewFileWriter(nil, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		if err := w.Handle(testBlock(i)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	w.Close()
+
+	// partial write before a crash
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0xff, 0x01, 0x02})
+	f.Close()
+
+	w, err = NewFileWriter(nil, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if last, ok := w.LastBlock(); !ok || last != 9 {
+		t.Errorf("expected last block 9, got %d", last)
+	}
+	w.Handle(testBlock(10))
+	w.Close()
+
+	// blocks without tx have no time, and the rebuilt index is the same
+	index, _ := os.ReadFile(path + IndexSuffix)
+	if bytes.Contains(index, []byte(`"time"`)) {
+		t.Errorf("unexpected time in the index: %s", index)
+	}
+	if err := Reindex(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rebuilt, _ := os.ReadFile(path + IndexSuffix); !bytes.Equal(rebuilt, index) {
+		t.Errorf("expected index %s, got %s", index, rebuilt)
+	}
+	r, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer r.Close()
+	if h := r.Height(); h != 11 {
+		t.Errorf("expected height 11, got %d", h)
+	}
+	b, err := r.QueryBlock(10)
+	if err != nil || b.Num != 10 {
+		t.Errorf("unexpected block %v, %v", b, err)
+	}
+	count := 0
+	r.Range(3, 7, func(*common.Block) error {
+		count++
+		return nil
+	})
+	if count != 5 {
+		t.Errorf("expected 5 blocks, got %d", count)
+	}
+}
@@ -0,0 +1,430 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// IndexSuffix is appended to the archive file path for the index file
+const IndexSuffix = ".idx"
+
+// IndexEntry is a line of the index file (JSON lines), it locates a block in the archive file
+type IndexEntry struct {
+	Block  uint64     `json:"block"`
+	Offset int64      `json:"offset"` // of the marshaled block, after the length prefix
+	Size   int        `json:"size"`
+	Time   *time.Time `json:"time,omitempty"` // latest tx timestamp, nil if the block has no tx
+	Txs    []string   `json:"txs"`            // tx IDs in order
+}
+
+// time returns the zero time if the block has no timestamp, so it is before any time
+func (e IndexEntry) time() time.Time {
+	if e.Time == nil {
+		return time.Time{}
+	}
+	return *e.Time
+}
+
+func newIndexEntry(b *block.Block, offset int64, size int) IndexEntry {
+	e := IndexEntry{Block: b.Num, Offset: offset, Size: size, Txs: []string{}}
+	if ts := b.Timestamp(); ts != nil {
+		t := ts.UTC()
+		e.Time = &t
+	}
+	for _, t := range b.Txs {
+		e.Txs = append(e.Txs, t.ID())
+	}
+	return e
+}
+
+type fileIndex struct {
+	entries []IndexEntry // ordered by block number
+	blocks  map[uint64]int
+	txs     map[string]int
+	size    int64 // valid size of the index file
+}
+
+func (idx *fileIndex) add(e IndexEntry) {
+	idx.blocks[e.Block] = len(idx.entries)
+	for _, id := range e.Txs {
+		if _, ok := idx.txs[id]; !ok { // the first one is valid for duplicated tx IDs
+			idx.txs[id] = len(idx.entries)
+		}
+	}
+	idx.entries = append(idx.entries, e)
+}
+
+func (idx *fileIndex) end() int64 {
+	if len(idx.entries) == 0 {
+		return 0
+	}
+	last := idx.entries[len(idx.entries)-1]
+	return last.Offset + int64(last.Size)
+}
+
+// loadFileIndex reads the index file, a partially written last line is ignored
+func loadFileIndex(path string) (*fileIndex, error) {
+	idx := &fileIndex{blocks: map[uint64]int{}, txs: map[string]int{}}
+	f, err := os.Open(path + IndexSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return idx, nil // ignores the line without newline
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e IndexEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("corrupted index at %d: %w", idx.size, err)
+		}
+		idx.add(e)
+		idx.size += int64(len(line))
+	}
+}
+
+// FileWriter is a block handler appending raw blocks to an archive file
+// (uvarint-length-prefixed marshaled common.Block) and the index to '<path>.idx'.
+// Data after the last indexed block (ex, written before a crash) is truncated on open.
+type FileWriter struct {
+	next block.Handler
+
+	mutex sync.Mutex
+	data  *os.File
+	index *os.File
+	idx   *fileIndex
+}
+
+func NewFileWriter(next block.Handler, path string) (*FileWriter, error) {
+	idx, err := loadFileIndex(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load archive index: %w", err)
+	}
+	data, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	info, err := data.Stat()
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	if info.Size() < idx.end() {
+		data.Close()
+		return nil, fmt.Errorf("archive file is shorter than the index: %d < %d", info.Size(), idx.end())
+	}
+	index, err := os.OpenFile(path+IndexSuffix, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		data.Close()
+		return nil, fmt.Errorf("failed to open archive index: %w", err)
+	}
+	err = truncate(data, idx.end())
+	if err == nil {
+		err = truncate(index, idx.size)
+	}
+	if err != nil {
+		data.Close()
+		index.Close()
+		return nil, fmt.Errorf("failed to truncate archive: %w", err)
+	}
+	return &FileWriter{next: next, data: data, index: index, idx: idx}, nil
+}
+
+// FirstBlock returns the first archived block number
+func (w *FileWriter) FirstBlock() (uint64, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.idx.entries) == 0 {
+		return 0, false
+	}
+	return w.idx.entries[0].Block, true
+}
+
+// LastBlock returns the last archived block number, listen from the next block to resume
+func (w *FileWriter) LastBlock() (uint64, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.idx.entries) == 0 {
+		return 0, false
+	}
+	return w.idx.entries[len(w.idx.entries)-1].Block, true
+}
+
+func (w *FileWriter) Handle(b *block.Block) error {
+	if err := w.append(b); err != nil {
+		return err
+	}
+	if w.next != nil {
+		return w.next.Handle(b)
+	}
+	return nil
+}
+
+func (w *FileWriter) append(b *block.Block) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if n := len(w.idx.entries); n > 0 && b.Num <= w.idx.entries[n-1].Block {
+		return nil // already archived
+	}
+
+	data, err := proto.Marshal(b.Block)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block: %w", err)
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+	e := newIndexEntry(b, w.idx.end()+int64(n), len(data))
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// the block is written before the index, so the index never refers to missing data
+	if err := writeFrame(w.data, data); err != nil {
+		return fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if _, err := w.index.Write(line); err != nil {
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+	w.idx.add(e)
+	w.idx.size += int64(len(line))
+	return nil
+}
+
+// Flush commits the written data to the disk
+func (w *FileWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := w.data.Sync(); err != nil {
+		return err
+	}
+	return w.index.Sync()
+}
+
+func (w *FileWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	err := w.data.Close()
+	if e := w.index.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// FileReader reads blocks and transactions from an archive file by the index
+type FileReader struct {
+	data *os.File
+	idx  *fileIndex
+}
+
+func OpenFile(path string) (*FileReader, error) {
+	idx, err := loadFileIndex(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load archive index: %w", err)
+	}
+	data, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	return &FileReader{data: data, idx: idx}, nil
+}
+
+func (r *FileReader) Close() error {
+	return r.data.Close()
+}
+
+// Height returns the next block number of the last archived block, 0 if empty
+func (r *FileReader) Height() uint64 {
+	if len(r.idx.entries) == 0 {
+		return 0
+	}
+	return r.idx.entries[len(r.idx.entries)-1].Block + 1
+}
+
+func (r *FileReader) read(e IndexEntry) (*common.Block, error) {
+	data := make([]byte, e.Size)
+	if _, err := r.data.ReadAt(data, e.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read block %d: %w", e.Block, err)
+	}
+	b := &common.Block{}
+	if err := proto.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block %d: %w", e.Block, err)
+	}
+	if b.Header == nil || b.Header.Number != e.Block {
+		return nil, fmt.Errorf("corrupted block %d", e.Block)
+	}
+	return b, nil
+}
+
+// QueryBlock returns ldgclient.ErrBlockNotFound if the block is not archived
+func (r *FileReader) QueryBlock(blockNum uint64) (*block.Block, error) {
+	i, ok := r.idx.blocks[blockNum]
+	if !ok {
+		return nil, ldgclient.ErrBlockNotFound
+	}
+	cb, err := r.read(r.idx.entries[i])
+	if err != nil {
+		return nil, err
+	}
+	return block.New(cb)
+}
+
+func (r *FileReader) QueryBlockByTxID(txID string) (*block.Block, error) {
+	i, ok := r.idx.txs[txID]
+	if !ok {
+		return nil, fmt.Errorf("tx not found: %s", txID)
+	}
+	return r.QueryBlock(r.idx.entries[i].Block)
+}
+
+func (r *FileReader) QueryTransaction(txID string) (*tx.Tx, error) {
+	b, err := r.QueryBlockByTxID(txID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range b.Txs {
+		if t.ID() == txID {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("tx not found: %s", txID)
+}
+
+// FindBlockByTime returns the first archived block whose timestamp is at or after t
+func (r *FileReader) FindBlockByTime(t time.Time) (uint64, error) {
+	i := sort.Search(len(r.idx.entries), func(i int) bool { return !r.idx.entries[i].time().Before(t) })
+	if i == len(r.idx.entries) {
+		return 0, ldgclient.ErrBlockNotFound
+	}
+	return r.idx.entries[i].Block, nil
+}
+
+// FindLastBlockByTime returns the last archived block whose timestamp is at or before t
+func (r *FileReader) FindLastBlockByTime(t time.Time) (uint64, error) {
+	i := sort.Search(len(r.idx.entries), func(i int) bool { return r.idx.entries[i].time().After(t) })
+	if i == 0 {
+		return 0, ldgclient.ErrBlockNotFound
+	}
+	return r.idx.entries[i-1].Block, nil
+}
+
+// Range calls fn for each archived block from 'from' to 'to' (inclusive) in order, All 'to' is the last block
+func (r *FileReader) Range(from, to uint64, fn func(*common.Block) error) error {
+	i := sort.Search(len(r.idx.entries), func(i int) bool { return r.idx.entries[i].Block >= from })
+	for ; i < len(r.idx.entries) && r.idx.entries[i].Block <= to; i++ {
+		b, err := r.read(r.idx.entries[i])
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay handles the archived blocks from 'from' to 'to' with the handler as if they were delivered
+func (r *FileReader) Replay(from, to uint64, handler block.Handler) error {
+	return replay(r.Range, from, to, handler)
+}
+
+// Reindex rebuilds the index file by scanning the archive file, the data after a corrupted frame is dropped.
+// The index is written to a temporary file and replaces the index file when it is done.
+func Reindex(path string) error {
+	data, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer data.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+IndexSuffix+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive index: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	if err := reindex(bufio.NewReader(data), tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path+IndexSuffix)
+}
+
+func reindex(r *bufio.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	offset := int64(0)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			break // io.EOF or corrupted
+		}
+		cb := &common.Block{}
+		if err := proto.Unmarshal(frame, cb); err != nil || cb.Header == nil {
+			break
+		}
+		b, err := block.New(cb)
+		if err != nil {
+			break
+		}
+		prefixSize := int64(uvarintSize(uint64(len(frame))))
+		line, err := json.Marshal(newIndexEntry(b, offset+prefixSize, len(frame)))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write archive index: %w", err)
+		}
+		offset += prefixSize + int64(len(frame))
+	}
+	return w.Flush()
+}
+
+// truncate drops the data after the size and moves the offset to the end
+func truncate(f *os.File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	_, err := f.Seek(size, io.SeekStart)
+	return err
+}
+
+func uvarintSize(v uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], v)
+}
@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+// All is the 'to' value for ranging to the last block
+const All uint64 = math.MaxUint64
+
+// ErrStop can be returned by range functions to stop ranging without an error
+var ErrStop = errors.New("stop ranging")
+
+// Reader reads blocks archived by Writer
+type Reader struct {
+	store Store
+}
+
+func NewReader(store Store) *Reader {
+	return &Reader{store: store}
+}
+
+func (r *Reader) Manifest() (*Manifest, error) {
+	return loadManifest(r.store)
+}
+
+// Height returns the next block number of the last archived block, 0 if empty
+func (r *Reader) Height() (uint64, error) {
+	m, err := r.Manifest()
+	if err != nil {
+		return 0, err
+	}
+	last, ok := m.LastBlock()
+	if !ok {
+		return 0, nil
+	}
+	return last + 1, nil
+}
+
+// Range calls fn for each block from 'from' to 'to' (inclusive) in order, All 'to' is the last block
+func (r *Reader) Range(from, to uint64, fn func(*common.Block) error) error {
+	m, err := r.Manifest()
+	if err != nil {
+		return err
+	}
+	for _, seg := range m.Segments {
+		if seg.Last < from || seg.First > to {
+			continue
+		}
+		data, err := r.store.Get(seg.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get segment %s: %w", seg.Name, err)
+		}
+		err = readSegment(data, func(b *common.Block) error {
+			num := b.Header.Number
+			if num < from || num > to {
+				return nil
+			}
+			return fn(b)
+		})
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("segment %s: %w", seg.Name, err)
+		}
+	}
+	return nil
+}
+
+// Replay handles the archived blocks from 'from' to 'to' with the handler as if they were delivered
+func (r *Reader) Replay(from, to uint64, handler block.Handler) error {
+	return replay(r.Range, from, to, handler)
+}
+
+func replay(rangeFn func(uint64, uint64, func(*common.Block) error) error, from, to uint64, handler block.Handler) error {
+	if handler == nil {
+		return errors.New("block handler is nil")
+	}
+	return rangeFn(from, to, func(cb *common.Block) error {
+		b, err := block.New(cb)
+		if err != nil {
+			return fmt.Errorf("failed to parse block data: %w", err)
+		}
+		return handler.Handle(b)
+	})
+}
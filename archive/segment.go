@@ -0,0 +1,273 @@
+// Package archive keeps raw blocks in compressed segment files with a manifest,
+// in a local directory or a S3 bucket, independent of peers.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+const ManifestName = "manifest.json"
+
+// larger than the maximum block size of Fabric, guards corrupted length prefixes
+const maxFrameSize = 1 << 30
+
+// Segment is a gzip file of uvarint-length-prefixed marshaled common.Block frames
+type Segment struct {
+	Name   string `json:"name"`
+	First  uint64 `json:"first"`
+	Last   uint64 `json:"last"`
+	Blocks int    `json:"blocks"`
+	Size   int    `json:"size"` // compressed
+}
+
+// Manifest is the index of segments ordered by block number
+type Manifest struct {
+	Version  int       `json:"version"`
+	Segments []Segment `json:"segments"`
+}
+
+// LastBlock returns the last archived block number, ok is false if nothing is archived
+func (m *Manifest) LastBlock() (blockNum uint64, ok bool) {
+	if len(m.Segments) == 0 {
+		return 0, false
+	}
+	return m.Segments[len(m.Segments)-1].Last, true
+}
+
+func loadManifest(store Store) (*Manifest, error) {
+	data, err := store.Get(ManifestName)
+	if errors.Is(err, ErrNotExist) {
+		return &Manifest{Version: 1}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest: %w", err)
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	return m, nil
+}
+
+// writeFrame writes the uvarint length prefix and the data
+func writeFrame(w io.Writer, data []byte) error {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(data)))
+	if _, err := w.Write(prefix[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame returns io.EOF at the end, io.ErrUnexpectedEOF if the frame is truncated
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err // io.EOF only if no byte is read
+	}
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("invalid frame size: %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Writer is a block handler archiving raw blocks into segments rotated by size.
+// Buffered blocks are written as a segment when it is flushed (the listener flushes it on shutdown),
+// so blocks after the last segment are lost on a crash and must be listened again from LastBlock + 1,
+// even if a checkpoint of the next handlers is ahead of it.
+// Blocks at or below the last archived block are not archived again.
+type Writer struct {
+	store   Store
+	next    block.Handler
+	maxSize int
+
+	mutex    sync.Mutex
+	manifest *Manifest
+	buf      bytes.Buffer
+	gz       *gzip.Writer
+	first    uint64
+	last     uint64
+	count    int
+	raw      int // uncompressed size
+}
+
+type WriterOption func(*Writer) error
+
+// NewWriter returns an archive writer, default segment size is 64MiB (uncompressed)
+func NewWriter(next block.Handler, store Store, options ...WriterOption) (*Writer, error) {
+	if store == nil {
+		return nil, errors.New("archive store is nil")
+	}
+	manifest, err := loadManifest(store)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		store:    store,
+		next:     next,
+		maxSize:  64 << 20,
+		manifest: manifest,
+	}
+	for _, option := range options {
+		if err := option(w); err != nil {
+			return nil, fmt.Errorf("failed to apply archive option: %w", err)
+		}
+	}
+	return w, nil
+}
+
+// LastBlock returns the last archived block number, listen from the next block to resume
+func (w *Writer) LastBlock() (uint64, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.manifest.LastBlock()
+}
+
+func (w *Writer) Handle(b *block.Block) error {
+	if err := w.archive(b); err != nil {
+		return err
+	}
+	if w.next != nil {
+		return w.next.Handle(b)
+	}
+	return nil
+}
+
+func (w *Writer) archive(b *block.Block) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if last, ok := w.manifest.LastBlock(); ok && b.Num <= last {
+		return nil // already archived
+	}
+	if w.count > 0 && b.Num <= w.last {
+		return nil
+	}
+
+	data, err := proto.Marshal(b.Block)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block: %w", err)
+	}
+	if w.gz == nil {
+		w.buf.Reset()
+		w.gz = gzip.NewWriter(&w.buf)
+		w.first = b.Num
+	}
+	if err := writeFrame(w.gz, data); err != nil {
+		return err
+	}
+	w.last = b.Num
+	w.count++
+	w.raw += len(data)
+
+	if w.raw >= w.maxSize {
+		return w.rotate()
+	}
+	return nil
+}
+
+// Flush writes the buffered blocks as a segment
+func (w *Writer) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.rotate()
+}
+
+// Close writes the buffered blocks as a segment, the writer has no other resource
+func (w *Writer) Close() error {
+	return w.Flush()
+}
+
+// rotate MUST be called with the lock
+func (w *Writer) rotate() error {
+	if w.gz == nil || w.count == 0 {
+		return nil
+	}
+	if err := w.gz.Close(); err != nil {
+		return err
+	}
+	seg := Segment{
+		Name:   fmt.Sprintf("%020d-%020d.blocks.gz", w.first, w.last),
+		First:  w.first,
+		Last:   w.last,
+		Blocks: w.count,
+		Size:   w.buf.Len(),
+	}
+	if err := w.store.Put(seg.Name, w.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to put segment: %w", err)
+	}
+
+	manifest := *w.manifest
+	manifest.Segments = append(append([]Segment{}, w.manifest.Segments...), seg)
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the segment is put before the manifest, so the manifest never refers to a missing segment
+	if err := w.store.Put(ManifestName, data); err != nil {
+		return fmt.Errorf("failed to put manifest: %w", err)
+	}
+	w.manifest = &manifest
+	w.gz = nil
+	w.count = 0
+	w.raw = 0
+	return nil
+}
+
+// WithSegmentSize sets the uncompressed size of blocks in a segment to rotate
+func WithSegmentSize(size int) WriterOption {
+	return func(w *Writer) error {
+		if size <= 0 {
+			return fmt.Errorf("invalid segment size: %d", size)
+		}
+		w.maxSize = size
+		return nil
+	}
+}
+
+// readSegment calls fn for each block in the segment data
+func readSegment(data []byte, fn func(*common.Block) error) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer gz.Close()
+	r := bufio.NewReader(gz)
+	for {
+		frame, err := readFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read segment: %w", err)
+		}
+		b := &common.Block{}
+		if err := proto.Unmarshal(frame, b); err != nil {
+			return fmt.Errorf("failed to unmarshal block: %w", err)
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	patrasche_aws "github.com/key-inside/patrasche/aws"
+)
+
+// ErrNotExist is returned by Store.Get when the object doesn't exist
+var ErrNotExist = errors.New("object does not exist")
+
+// Store keeps archive objects (segments and the manifest) by name
+type Store interface {
+	Put(name string, data []byte) error
+	Get(name string) ([]byte, error)
+	List() ([]string, error) // sorted names
+}
+
+// DirStore stores objects as files in a local directory
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Put writes the object to a temporary file and renames it, so readers never see a partial object
+func (s *DirStore) Put(name string, data []byte) error {
+	path := filepath.Join(s.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *DirStore) Get(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	return data, err
+}
+
+func (s *DirStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// S3Store stores objects in a S3 bucket under the prefix
+type S3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewS3Store(cfg aws.Config, bucket, prefix string) *S3Store {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Store{
+		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.UsePathStyle = cfg.EndpointResolverWithOptions != nil // for local stand-ins
+		}),
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (s *S3Store) Put(name string, data []byte) error {
+	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(name string) ([]byte, error) {
+	out, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err != nil {
+		var nsk *types.NoSuchKey
+		if errors.As(err, &nsk) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (s *S3Store) List() ([]string, error) {
+	names := []string{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			names = append(names, strings.TrimPrefix(aws.ToString(obj.Key), s.prefix))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// OpenStore opens a store by the location, 's3://bucket/prefix' or a local directory path
+func OpenStore(location string, cfg func() aws.Config) (Store, error) {
+	if strings.HasPrefix(location, "s3://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 location: %w", err)
+		}
+		if cfg == nil {
+			cfg = func() aws.Config { return patrasche_aws.DefaultConfig() }
+		}
+		return NewS3Store(cfg(), u.Host, strings.TrimPrefix(u.Path, "/")), nil
+	}
+	return NewDirStore(location)
+}
@@ -0,0 +1,203 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/key-inside/patrasche/tx"
+)
+
+// Batch is a sequence of blocks handled at once
+type Batch struct {
+	Blocks []*Block
+	Bytes  int // total size of marshaled blocks
+}
+
+// Txs returns all transactions of the blocks in order
+func (b *Batch) Txs() []*tx.Tx {
+	txs := []*tx.Tx{}
+	for _, block := range b.Blocks {
+		txs = append(txs, block.Txs...)
+	}
+	return txs
+}
+
+// Last returns the last block of the batch
+func (b *Batch) Last() *Block {
+	if len(b.Blocks) == 0 {
+		return nil
+	}
+	return b.Blocks[len(b.Blocks)-1]
+}
+
+type BatchHandler interface {
+	HandleBatch(batch *Batch) error
+}
+
+// BatchHandlerFunc is an adapter to allow the use of ordinary functions as batch handlers
+type BatchHandlerFunc func(*Batch) error
+
+func (f BatchHandlerFunc) HandleBatch(batch *Batch) error {
+	return f(batch)
+}
+
+// Flusher is implemented by handlers buffering blocks.
+// The listener flushes its handler when listening is finished, see Chain for flushing wrapped handlers.
+type Flusher interface {
+	Flush() error
+}
+
+// Batcher accumulates blocks and hands them to the batch handler
+// when the number of blocks, transactions, bytes or the time window reaches the limit.
+// The next handler is called for each block only after its batch is committed,
+// so a checkpoint writer as the next handler never advances ahead of the batch handler.
+// A failed batch remains pending and is retried by the next flush.
+type Batcher struct {
+	batch     BatchHandler
+	next      Handler
+	maxBlocks int
+	maxTxs    int
+	maxBytes  int
+	window    time.Duration
+	onError   func(error)
+
+	mutex   sync.Mutex
+	pending Batch
+	txCount int
+	timer   *time.Timer
+	err     error // error of flushing by the time window, returned by the next Handle
+}
+
+type BatchOption func(*Batcher) error
+
+// NewBatcher returns a batcher, default limits are 100 blocks and 1 second window
+func NewBatcher(next Handler, batch BatchHandler, options ...BatchOption) (*Batcher, error) {
+	if batch == nil {
+		return nil, errors.New("batch handler is nil")
+	}
+	b := &Batcher{
+		batch:     batch,
+		next:      next,
+		maxBlocks: 100,
+		window:    time.Second,
+	}
+	for _, option := range options {
+		if err := option(b); err != nil {
+			return nil, fmt.Errorf("failed to apply batch option: %w", err)
+		}
+	}
+	return b, nil
+}
+
+func (b *Batcher) Handle(block *Block) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err := b.err; err != nil {
+		b.err = nil
+		return fmt.Errorf("failed to flush batch by the time window: %w", err)
+	}
+
+	b.pending.Blocks = append(b.pending.Blocks, block)
+	b.pending.Bytes += proto.Size(block.Block)
+	b.txCount += len(block.Txs)
+
+	if (b.maxBlocks > 0 && len(b.pending.Blocks) >= b.maxBlocks) ||
+		(b.maxTxs > 0 && b.txCount >= b.maxTxs) ||
+		(b.maxBytes > 0 && b.pending.Bytes >= b.maxBytes) {
+		return b.flush()
+	}
+
+	if b.window > 0 && b.timer == nil {
+		b.timer = time.AfterFunc(b.window, func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			b.timer = nil
+			if err := b.flush(); err != nil {
+				b.err = err
+				if b.onError != nil {
+					b.onError(err)
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// Flush commits the pending blocks, including a batch failed by the time window
+func (b *Batcher) Flush() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.err = nil
+	return b.flush()
+}
+
+// flush MUST be called with the lock
+func (b *Batcher) flush() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending.Blocks) == 0 {
+		return nil
+	}
+	batch := b.pending
+	if err := b.batch.HandleBatch(&batch); err != nil {
+		return err
+	}
+	b.pending = Batch{}
+	b.txCount = 0
+	if b.next != nil {
+		for _, block := range batch.Blocks {
+			if err := b.next.Handle(block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WithBatchBlocks sets the maximum number of blocks in a batch, 0 is unlimited
+func WithBatchBlocks(n int) BatchOption {
+	return func(b *Batcher) error {
+		b.maxBlocks = n
+		return nil
+	}
+}
+
+// WithBatchTxs sets the maximum number of transactions in a batch, 0 is unlimited
+func WithBatchTxs(n int) BatchOption {
+	return func(b *Batcher) error {
+		b.maxTxs = n
+		return nil
+	}
+}
+
+// WithBatchBytes sets the maximum size of marshaled blocks in a batch, 0 is unlimited
+func WithBatchBytes(n int) BatchOption {
+	return func(b *Batcher) error {
+		b.maxBytes = n
+		return nil
+	}
+}
+
+// WithBatchWindow sets the maximum time that the first block waits in a batch, 0 is unlimited
+func WithBatchWindow(d time.Duration) BatchOption {
+	return func(b *Batcher) error {
+		b.window = d
+		return nil
+	}
+}
+
+// WithBatchOnError sets the function called as soon as flushing by the time window fails,
+// the error is also returned by the next Handle
+func WithBatchOnError(onError func(error)) BatchOption {
+	return func(b *Batcher) error {
+		b.onError = onError
+		return nil
+	}
+}
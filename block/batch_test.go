@@ -0,0 +1,133 @@
+package block
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Batcher(t *testing.T) {
+	batches := [][]uint64{}
+	checkpoints := []uint64{}
+	fail := false
+	batch := BatchHandlerFunc(func(b *Batch) error {
+		if fail {
+			return errors.New("failed")
+		}
+		nums := []uint64{}
+		for _, block := range b.Blocks {
+			nums = append(nums, block.Num)
+		}
+		batches = append(batches, nums)
+		return nil
+	})
+	checkpoint := HandlerFunc(func(b *Block) error {
+		checkpoints = append(checkpoints, b.Num)
+		return nil
+	})
+
+	b, err := NewBatcher(checkpoint, batch, WithBatchBlocks(2), WithBatchWindow(0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		if err := b.Handle(&Block{Num: i}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if expected := []uint64{1, 2}; !reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("expected checkpoints %v, got %v", expected, checkpoints)
+	}
+
+	// failed batch doesn't advance the checkpoint and remains pending
+	fail = true
+	if err := b.Flush(); err == nil {
+		t.Error("expected flush error")
+	}
+	fail = false
+	if err := b.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := [][]uint64{{1, 2}, {3}}; !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, batches)
+	}
+	if expected := []uint64{1, 2, 3}; !reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("expected checkpoints %v, got %v", expected, checkpoints)
+	}
+}
+
+func Test_BatcherWindow(t *testing.T) {
+	done := make(chan int, 1)
+	batch := BatchHandlerFunc(func(b *Batch) error {
+		done <- len(b.Blocks)
+		return nil
+	})
+	b, err := NewBatcher(nil, batch, WithBatchWindow(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b.Handle(&Block{Num: 1})
+	b.Handle(&Block{Num: 2})
+	select {
+	case n := <-done:
+		if n != 2 {
+			t.Errorf("expected 2 blocks, got %d", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("batch is not flushed by the window")
+	}
+}
+
+func Test_BatcherWindowError(t *testing.T) {
+	var mutex sync.Mutex
+	fail := true
+	batches := [][]uint64{}
+	batch := BatchHandlerFunc(func(b *Batch) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if fail {
+			return errors.New("failed")
+		}
+		nums := []uint64{}
+		for _, block := range b.Blocks {
+			nums = append(nums, block.Num)
+		}
+		batches = append(batches, nums)
+		return nil
+	})
+	reported := make(chan error, 1)
+	b, err := NewBatcher(nil, batch, WithBatchWindow(10*time.Millisecond), WithBatchOnError(func(err error) { reported <- err }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b.Handle(&Block{Num: 1})
+	b.Handle(&Block{Num: 2})
+
+	// reported right away
+	select {
+	case err := <-reported:
+		if err == nil {
+			t.Error("expected window flush error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("window flush error is not reported")
+	}
+
+	// returned once by the next Handle, the block is not accepted
+	if err := b.Handle(&Block{Num: 3}); err == nil {
+		t.Error("expected window flush error")
+	}
+
+	// pending blocks are kept for retry
+	mutex.Lock()
+	fail = false
+	mutex.Unlock()
+	if err := b.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := [][]uint64{{1, 2}}; !reflect.DeepEqual(batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, batches)
+	}
+}
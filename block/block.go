@@ -3,8 +3,8 @@ package block
 import (
 	"github.com/hyperledger/fabric-protos-go/common"
 
-	"github.com/key-inside/patrasche/proto"
 	"github.com/key-inside/patrasche/tx"
+	"github.com/key-inside/patrasche/tx/timestamp"
 )
 
 type Block struct {
@@ -24,11 +24,7 @@ func New(block *common.Block) (*Block, error) {
 	txs := []*tx.Tx{}
 	for i, data := range block.Data.Data {
 		validationByte := block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER][i] // BlockMetadataIndex_TRANSACTIONS_FILTER = 2
-		envelope, err := proto.UnmarshalEnvelope(data)
-		if err != nil {
-			return nil, err
-		}
-		t, err := tx.New(block.Header.Number, i, validationByte, envelope.Payload)
+		t, err := tx.NewFromEnvelope(block.Header.Number, i, validationByte, data)
 		if err != nil {
 			return nil, err
 		}
@@ -42,3 +38,16 @@ func New(block *common.Block) (*Block, error) {
 		Txs:   txs,
 	}, nil
 }
+
+// Timestamp returns the latest timestamp of the transactions in the block.
+// It returns nil if the block has no transaction.
+func (b *Block) Timestamp() *timestamp.Timestamp {
+	var latest *timestamp.Timestamp
+	for _, t := range b.Txs {
+		ts := t.Timestamp()
+		if latest == nil || ts.UTC().After(latest.UTC()) {
+			latest = ts
+		}
+	}
+	return latest
+}
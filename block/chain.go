@@ -0,0 +1,143 @@
+package block
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rs/zerolog"
+
+	"github.com/key-inside/patrasche/deadletter"
+	"github.com/key-inside/patrasche/retry"
+)
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as block handlers
+type HandlerFunc func(*Block) error
+
+func (f HandlerFunc) Handle(block *Block) error {
+	return f(block)
+}
+
+// Middleware wraps the next handler
+type Middleware func(next Handler) Handler
+
+// Chain builds a handler from the final handler and middlewares.
+// Blocks pass through the middlewares in the given order, so the first one is the outermost.
+// If any handler in the chain is a Flusher, ex) Batcher, the chain is a Flusher flushing them top-down.
+func Chain(final Handler, mws ...Middleware) Handler {
+	h := final
+	flushers := []Flusher{}
+	if f, ok := h.(Flusher); ok {
+		flushers = append(flushers, f)
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+		if f, ok := h.(Flusher); ok {
+			flushers = append([]Flusher{f}, flushers...)
+		}
+	}
+	if len(flushers) == 0 {
+		return h
+	}
+	return &chain{Handler: h, flushers: flushers}
+}
+
+type chain struct {
+	Handler
+	flushers []Flusher // top-down
+}
+
+// Flush flushes outer handlers first, so blocks flushed to inner ones are flushed again
+func (c *chain) Flush() error {
+	for _, f := range c.flushers {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type tee struct {
+	handlers []Handler
+}
+
+// Tee hands the block to all handlers in order and stops at the first error
+func Tee(handlers ...Handler) Handler {
+	return &tee{handlers: handlers}
+}
+
+func (t *tee) Handle(block *Block) error {
+	for _, h := range t.handlers {
+		if h == nil {
+			continue
+		}
+		if err := h.Handle(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type route struct {
+	predicate func(*Block) bool
+	then      Handler
+	otherwise Handler
+}
+
+// Route hands the block to 'then' if the predicate returns true, otherwise to 'otherwise'.
+// Both handlers can be nil.
+func Route(predicate func(*Block) bool, then, otherwise Handler) Handler {
+	return &route{
+		predicate: predicate,
+		then:      then,
+		otherwise: otherwise,
+	}
+}
+
+func (r *route) Handle(block *Block) error {
+	h := r.otherwise
+	if r.predicate(block) {
+		h = r.then
+	}
+	if h != nil {
+		return h.Handle(block)
+	}
+	return nil
+}
+
+// middleware presets
+
+func StdLogger(logger *zerolog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return NewStdLogger(next, logger)
+	}
+}
+
+func HashFilter(pattern string, filteredActions ...Action) Middleware {
+	return func(next Handler) Handler {
+		return NewHashFilter(next, pattern, filteredActions...)
+	}
+}
+
+func BlockNumberFileWriter(path string) Middleware {
+	return func(next Handler) Handler {
+		return NewBlockNumberFileWriter(next, path)
+	}
+}
+
+func BlockNumberDynamoDBWriter(awsCfg aws.Config, table string, itemFactory func(*Block) any) Middleware {
+	return func(next Handler) Handler {
+		return NewBlockNumberDynamoDBWriter(next, awsCfg, table, itemFactory)
+	}
+}
+
+func Retry(ctx context.Context, policy *retry.Policy) Middleware {
+	return func(next Handler) Handler {
+		return NewRetryHandler(ctx, next, policy)
+	}
+}
+
+func DeadLetter(sink deadletter.Sink) Middleware {
+	return func(next Handler) Handler {
+		return NewDeadLetterHandler(next, sink)
+	}
+}
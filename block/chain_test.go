@@ -0,0 +1,101 @@
+package block
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func Test_Chain(t *testing.T) {
+	trace := []string{}
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(b *Block) error {
+				trace = append(trace, name)
+				return next.Handle(b)
+			})
+		}
+	}
+	final := HandlerFunc(func(b *Block) error {
+		trace = append(trace, "final")
+		return nil
+	})
+
+	h := Chain(final, mw("first"), mw("second"), mw("third"))
+	if err := h.Handle(&Block{Num: 1}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"first", "second", "third", "final"}; !reflect.DeepEqual(trace, expected) {
+		t.Errorf("expected %v, got %v", expected, trace)
+	}
+}
+
+func Test_TeeAndRoute(t *testing.T) {
+	even, odd, all := 0, 0, 0
+	counter := func(n *int) Handler {
+		return HandlerFunc(func(b *Block) error {
+			*n++
+			return nil
+		})
+	}
+	h := Tee(
+		counter(&all),
+		Route(func(b *Block) bool { return b.Num%2 == 0 }, counter(&even), counter(&odd)),
+		Route(func(b *Block) bool { return b.Num > 100 }, nil, nil),
+	)
+	for i := uint64(0); i < 5; i++ {
+		if err := h.Handle(&Block{Num: i}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if all != 5 || even != 3 || odd != 2 {
+		t.Errorf("unexpected counts: all=%d, even=%d, odd=%d", all, even, odd)
+	}
+
+	failing := errors.New("fail")
+	h = Tee(HandlerFunc(func(*Block) error { return failing }), counter(&all))
+	if err := h.Handle(&Block{}); !errors.Is(err, failing) || all != 5 {
+		t.Errorf("tee must stop at the first error: %v, %d", err, all)
+	}
+}
+
+type testFlusher struct {
+	Handler
+	name  string
+	trace *[]string
+}
+
+func (f *testFlusher) Flush() error {
+	*f.trace = append(*f.trace, f.name)
+	return nil
+}
+
+func Test_ChainFlush(t *testing.T) {
+	trace := []string{}
+	flusher := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return &testFlusher{Handler: next, name: name, trace: &trace}
+		}
+	}
+	logger := func(next Handler) Handler {
+		return HandlerFunc(func(b *Block) error { return next.Handle(b) })
+	}
+	final := &testFlusher{Handler: HandlerFunc(func(*Block) error { return nil }), name: "final", trace: &trace}
+
+	// a flusher wrapped by middlewares is flushed through the chain
+	h := Chain(final, logger, flusher("batcher"), logger)
+	f, ok := h.(Flusher)
+	if !ok {
+		t.Fatal("chain having flushers must be a flusher")
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"batcher", "final"}; !reflect.DeepEqual(trace, expected) {
+		t.Errorf("expected %v, got %v", expected, trace)
+	}
+
+	if _, ok := Chain(HandlerFunc(func(*Block) error { return nil }), logger).(Flusher); ok {
+		t.Error("chain without flushers must not be a flusher")
+	}
+}
@@ -23,7 +23,10 @@ func NewHashFilter(next Handler, pattern string, filteredActions ...Action) Hand
 
 func (f *hashFilter) Handle(block *Block) error {
 	if f.hashPattern.MatchString(hex.EncodeToString(block.Hash)) {
-		return f.next.Handle(block)
+		if f.next != nil {
+			return f.next.Handle(block)
+		}
+		return nil
 	}
 	for _, action := range f.filteredActions {
 		if err := action(block); err != nil {
@@ -0,0 +1,104 @@
+package block
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/key-inside/patrasche/deadletter"
+	patrasche_proto "github.com/key-inside/patrasche/proto"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/tx"
+)
+
+type retryHandler struct {
+	ctx    context.Context
+	policy *retry.Policy
+	next   Handler
+}
+
+// NewRetryHandler retries the next handler by the policy.
+// Note that the whole block is handled again on retry. Waiting for the next attempt stops when ctx is done.
+func NewRetryHandler(ctx context.Context, next Handler, policy *retry.Policy) Handler {
+	return &retryHandler{
+		ctx:    ctx,
+		policy: policy,
+		next:   next,
+	}
+}
+
+func (h *retryHandler) Handle(block *Block) error {
+	if h.next == nil {
+		return nil
+	}
+	return h.policy.Do(h.ctx, func() error {
+		return h.next.Handle(block)
+	})
+}
+
+type deadLetterHandler struct {
+	sink deadletter.Sink
+	next Handler
+}
+
+// NewDeadLetterHandler skips the block that the next handler fails to handle
+// after recording the raw block into the sink.
+func NewDeadLetterHandler(next Handler, sink deadletter.Sink) Handler {
+	return &deadLetterHandler{
+		sink: sink,
+		next: next,
+	}
+}
+
+func (h *deadLetterHandler) Handle(block *Block) error {
+	if h.next == nil {
+		return nil
+	}
+	err := h.next.Handle(block)
+	if err == nil {
+		return nil
+	}
+	raw, mErr := proto.Marshal(block.Block)
+	if mErr != nil {
+		return fmt.Errorf("failed to marshal block (%v): %w", err, mErr)
+	}
+	r := deadletter.Record{
+		BlockNum: block.Num,
+		Error:    err.Error(),
+		Block:    raw,
+	}
+	if pErr := h.sink.Put(r); pErr != nil {
+		return fmt.Errorf("failed to put dead-letter (%v): %w", err, pErr)
+	}
+	return nil
+}
+
+// ReplayDeadLetters handles block records by the block handler and tx records by the tx handler.
+// Records of a kind are ignored if its handler is nil.
+func ReplayDeadLetters(src deadletter.Source, blockHandler Handler, txHandler tx.Handler) error {
+	return src.Range(func(r deadletter.Record) error {
+		if r.IsBlock() {
+			if blockHandler == nil {
+				return nil
+			}
+			pb, err := patrasche_proto.UnmarshalBlock(r.Block)
+			if err != nil {
+				return fmt.Errorf("failed to replay block %d: %w", r.BlockNum, err)
+			}
+			b, err := New(pb)
+			if err != nil {
+				return fmt.Errorf("failed to replay block %d: %w", r.BlockNum, err)
+			}
+			return blockHandler.Handle(b)
+		}
+		if txHandler == nil {
+			return nil
+		}
+		t, err := tx.NewFromEnvelope(r.BlockNum, r.Seq, byte(r.ValidationCode), r.Envelope)
+		if err != nil {
+			return fmt.Errorf("failed to replay tx %s: %w", r.TxID, err)
+		}
+		return txHandler.Handle(t)
+	})
+}
@@ -0,0 +1,138 @@
+package block_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/deadletter"
+	"github.com/key-inside/patrasche/testing/blocktest"
+	"github.com/key-inside/patrasche/tx"
+)
+
+type failingSink struct{}
+
+func (failingSink) Put(deadletter.Record) error {
+	return errors.New("sink unavailable")
+}
+
+func Test_DeadLetterReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletters.jsonl")
+	sink, err := deadletter.NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer sink.Close()
+
+	blocks := []*block.Block{}
+	for i := uint64(0); i < 3; i++ {
+		blocks = append(blocks, blocktest.NewBlock(i).
+			AddEndorserTx("token", "mint").
+			AddEndorserTx("token", "transfer").
+			Block().Parse())
+	}
+
+	// block 1 and the second tx of block 2 fail
+	failing := errors.New("handler failed")
+	txHandler := tx.NewDeadLetterHandler(tx.HandlerFunc(func(t *tx.Tx) error {
+		if t.BlockNum == 2 && t.Seq == 1 {
+			return failing
+		}
+		return nil
+	}), sink)
+	stdHandler, err := block.NewStdHandler(txHandler)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := block.NewDeadLetterHandler(block.HandlerFunc(func(b *block.Block) error {
+		if b.Num == 1 {
+			return failing
+		}
+		return stdHandler.Handle(b)
+	}), sink)
+	for _, b := range blocks {
+		if err := handler.Handle(b); err != nil {
+			t.Fatalf("block %d: Unexpected error: %v", b.Num, err)
+		}
+	}
+
+	records := []deadletter.Record{}
+	if err := deadletter.NewFileSource(path).Range(func(r deadletter.Record) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if !records[0].IsBlock() || records[0].BlockNum != 1 || records[0].Error != failing.Error() {
+		t.Errorf("unexpected block record: %+v", records[0])
+	}
+	if records[1].IsBlock() || records[1].TxID != blocks[2].Txs[1].ID() || records[1].Seq != 1 {
+		t.Errorf("unexpected tx record: %+v", records[1])
+	}
+
+	// replay
+	replayed := []string{}
+	blockHandler := block.HandlerFunc(func(b *block.Block) error {
+		replayed = append(replayed, "block:"+b.Txs[0].ID())
+		return nil
+	})
+	replayTxHandler := tx.HandlerFunc(func(t *tx.Tx) error {
+		replayed = append(replayed, "tx:"+t.ID())
+		return nil
+	})
+	src := deadletter.NewFileSource(path)
+	if err := block.ReplayDeadLetters(src, blockHandler, replayTxHandler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"block:" + blocks[1].Txs[0].ID(), "tx:" + blocks[2].Txs[1].ID()}
+	if !reflect.DeepEqual(replayed, expected) {
+		t.Errorf("expected %v, got %v", expected, replayed)
+	}
+
+	// records of a kind without its handler are ignored
+	replayed = replayed[:0]
+	if err := block.ReplayDeadLetters(src, nil, replayTxHandler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(replayed, expected[1:]) {
+		t.Errorf("expected %v, got %v", expected[1:], replayed)
+	}
+
+	// replay errors stop the replay
+	err = block.ReplayDeadLetters(src, block.HandlerFunc(func(b *block.Block) error { return failing }), replayTxHandler)
+	if !errors.Is(err, failing) {
+		t.Errorf("expected replay error, got %v", err)
+	}
+
+	// records appended while replaying are not read again
+	count := 0
+	if err := src.Range(func(r deadletter.Record) error {
+		count++
+		return sink.Put(r)
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 records, got %d", count)
+	}
+}
+
+func Test_DeadLetterSinkError(t *testing.T) {
+	failing := errors.New("handler failed")
+
+	b := blocktest.NewBlock(1).AddEndorserTx("token", "mint").Block().Parse()
+	handler := block.NewDeadLetterHandler(block.HandlerFunc(func(*block.Block) error { return failing }), failingSink{})
+	if err := handler.Handle(b); err == nil {
+		t.Error("expected error when the block can't be recorded")
+	}
+
+	txHandler := tx.NewDeadLetterHandler(tx.HandlerFunc(func(*tx.Tx) error { return failing }), failingSink{})
+	if err := txHandler.Handle(b.Txs[0]); err == nil {
+		t.Error("expected error when the tx can't be recorded")
+	}
+}
@@ -0,0 +1,124 @@
+// Package blockfile reads Fabric's native block files (chains/<channel>/blockfile_NNNNNN) without a peer.
+// A block file is a sequence of varint-length-prefixed serialized blocks.
+package blockfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+// CorruptionError is returned when a block file has invalid data
+type CorruptionError struct {
+	File   string
+	Offset int64
+	Block  uint64 // expected block number
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted block file %s at offset %d (block %d): %s", e.File, e.Offset, e.Block, e.Reason)
+}
+
+// Marshal serializes the block in Fabric's block file format (without the length prefix):
+// header (number, data hash, previous hash), data entries and metadata entries.
+func Marshal(b *common.Block) []byte {
+	var buf []byte
+	buf = appendUvarint(buf, b.Header.Number)
+	buf = appendRawBytes(buf, b.Header.DataHash)
+	buf = appendRawBytes(buf, b.Header.PreviousHash)
+	buf = appendUvarint(buf, uint64(len(b.Data.Data)))
+	for _, d := range b.Data.Data {
+		buf = appendRawBytes(buf, d)
+	}
+	metadata := [][]byte{}
+	if b.Metadata != nil {
+		metadata = b.Metadata.Metadata
+	}
+	buf = appendUvarint(buf, uint64(len(metadata)))
+	for _, m := range metadata {
+		buf = appendRawBytes(buf, m)
+	}
+	return buf
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+func appendRawBytes(buf, data []byte) []byte {
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errors.New("invalid varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) rawBytes() []byte {
+	size := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if size > uint64(len(d.data)) {
+		d.err = fmt.Errorf("bytes length %d exceeds the remaining %d", size, len(d.data))
+		return nil
+	}
+	v := d.data[:size]
+	d.data = d.data[size:]
+	return v
+}
+
+// Unmarshal deserializes a block in Fabric's block file format
+func Unmarshal(data []byte) (*common.Block, error) {
+	d := &decoder{data: data}
+	b := &common.Block{
+		Header:   &common.BlockHeader{},
+		Data:     &common.BlockData{},
+		Metadata: &common.BlockMetadata{},
+	}
+	b.Header.Number = d.uvarint()
+	b.Header.DataHash = d.rawBytes()
+	b.Header.PreviousHash = d.rawBytes()
+	n := d.uvarint()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		b.Data.Data = append(b.Data.Data, d.rawBytes())
+	}
+	n = d.uvarint()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		b.Metadata.Metadata = append(b.Metadata.Metadata, d.rawBytes())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.data) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes", len(d.data))
+	}
+	return b, nil
+}
+
+// DataHash returns the data hash of the block computed as Fabric does
+func DataHash(data *common.BlockData) []byte {
+	sum := sha256.Sum256(bytes.Join(data.Data, nil))
+	return sum[:]
+}
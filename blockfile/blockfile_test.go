@@ -0,0 +1,118 @@
+package blockfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/archive"
+	"github.com/key-inside/patrasche/block"
+)
+
+func testChain(n int) []*common.Block {
+	blocks := []*common.Block{}
+	var prevHash []byte
+	for i := 0; i < n; i++ {
+		b := &common.Block{
+			Header:   &common.BlockHeader{Number: uint64(i), PreviousHash: prevHash},
+			Data:     &common.BlockData{Data: [][]byte{{byte(i)}, {byte(i), 1}}},
+			Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {0, 0}, {}, {}}},
+		}
+		b.Header.DataHash = DataHash(b.Data)
+		prevHash, _ = block.GenerateHash(b)
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func writeBlockfile(t *testing.T, path string, blocks []*common.Block) {
+	var buf []byte
+	for _, b := range blocks {
+		data := Marshal(b)
+		buf = appendUvarint(buf, uint64(len(data)))
+		buf = append(buf, data...)
+	}
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func rangeNums(r *Reader, from, to uint64) ([]uint64, error) {
+	nums := []uint64{}
+	err := r.Range(from, to, func(b *common.Block) error {
+		nums = append(nums, b.Header.Number)
+		return nil
+	})
+	return nums, err
+}
+
+func Test_Reader(t *testing.T) {
+	dir := t.TempDir()
+	blocks := testChain(10)
+	writeBlockfile(t, filepath.Join(dir, "blockfile_000000"), blocks[:6])
+	writeBlockfile(t, filepath.Join(dir, "blockfile_000001"), blocks[6:])
+
+	// partially written block at the end of the last file
+	f, _ := os.OpenFile(filepath.Join(dir, "blockfile_000001"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{100, 1, 2})
+	f.Close()
+
+	r, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nums, err := rangeNums(r, 3, archive.All)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nums) != 7 || nums[0] != 3 || nums[6] != 9 {
+		t.Errorf("unexpected blocks: %v", nums)
+	}
+	if nums, _ = rangeNums(r, 2, 4); len(nums) != 3 {
+		t.Errorf("unexpected blocks: %v", nums)
+	}
+	if h, err := r.Height(); err != nil || h != 10 {
+		t.Errorf("expected height 10, got %d, %v", h, err)
+	}
+
+	// broken chain
+	blocks[7].Header.PreviousHash = []byte("wrong")
+	writeBlockfile(t, filepath.Join(dir, "blockfile_000001"), blocks[6:])
+	_, err = rangeNums(r, 0, archive.All)
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) || cerr.Block != 7 || cerr.File != "blockfile_000001" {
+		t.Errorf("expected corruption at block 7, got %v", err)
+	}
+	r, _ = Open(dir, WithoutVerification())
+	if nums, err = rangeNums(r, 0, archive.All); err != nil || len(nums) != 10 {
+		t.Errorf("unexpected result without verification: %v, %v", nums, err)
+	}
+
+	// truncated in the middle file
+	data, _ := os.ReadFile(filepath.Join(dir, "blockfile_000000"))
+	os.WriteFile(filepath.Join(dir, "blockfile_000000"), data[:len(data)-3], 0644)
+	if _, err = rangeNums(r, 0, archive.All); !errors.As(err, &cerr) || cerr.Block != 5 {
+		t.Errorf("expected corruption at block 5, got %v", err)
+	}
+}
+
+func Test_Unmarshal(t *testing.T) {
+	b := testChain(1)[0]
+	data := Marshal(b)
+	if _, err := Unmarshal(append(data, 0)); err == nil {
+		t.Error("expected trailing bytes error")
+	}
+	if _, err := Unmarshal(data[:len(data)-2]); err == nil {
+		t.Error("expected truncated error")
+	}
+	u, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if u.Header.Number != 0 || len(u.Data.Data) != 2 || len(u.Metadata.Metadata) != 5 {
+		t.Errorf("unexpected block: %v", u)
+	}
+}
@@ -0,0 +1,212 @@
+package blockfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/archive"
+	"github.com/key-inside/patrasche/block"
+)
+
+const filePrefix = "blockfile_"
+
+// larger than the maximum block size of Fabric, guards corrupted length prefixes
+const maxBlockSize = 1 << 30
+
+// Reader reads blocks from the block files in a directory, ex) a copy of chains/<channel>
+type Reader struct {
+	files  []string
+	verify bool
+}
+
+type Option func(*Reader) error
+
+// Open returns a reader of the block files in the directory.
+// By default, it verifies block numbers, data hashes and previous hashes.
+func Open(dir string, options ...Option) (*Reader, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block file directory: %w", err)
+	}
+	files := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no block file in %s", dir)
+	}
+	sort.Strings(files) // blockfile_000000, blockfile_000001, ...
+
+	r := &Reader{files: files, verify: true}
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, fmt.Errorf("failed to apply blockfile option: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// Files returns the block file paths in order
+func (r *Reader) Files() []string {
+	return r.files
+}
+
+// Range calls fn for each block from 'from' to 'to' (inclusive) in order, archive.All 'to' is the last block.
+// fn can return archive.ErrStop to stop ranging. A truncated block at the end of the last file (ex, being written by a peer) is ignored.
+func (r *Reader) Range(from, to uint64, fn func(*common.Block) error) error {
+	var prev *common.Block
+	for i, path := range r.files {
+		done, err := r.rangeFile(path, i == len(r.files)-1, &prev, from, to, fn)
+		if errors.Is(err, archive.ErrStop) {
+			return nil
+		}
+		if err != nil || done {
+			return err
+		}
+	}
+	return nil
+}
+
+// Height returns the next block number of the last block in the block files, 0 if empty.
+// Only the last files are read, without verification.
+func (r *Reader) Height() (uint64, error) {
+	nv := &Reader{files: r.files}
+	for i := len(r.files) - 1; i >= 0; i-- {
+		var last *common.Block
+		_, err := nv.rangeFile(r.files[i], i == len(r.files)-1, &last, 0, archive.All, func(*common.Block) error { return nil })
+		if err != nil {
+			return 0, err
+		}
+		if last != nil {
+			return last.Header.Number + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// rangeFile returns done if the block 'to' is handled
+func (r *Reader) rangeFile(path string, last bool, prev **common.Block, from, to uint64, fn func(*common.Block) error) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open block file: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 1<<20)
+	offset := int64(0)
+	corrupted := func(reason string) *CorruptionError {
+		expected := uint64(0)
+		if *prev != nil {
+			expected = (*prev).Header.Number + 1
+		}
+		return &CorruptionError{File: filepath.Base(path), Offset: offset, Block: expected, Reason: reason}
+	}
+
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			if last && errors.Is(err, io.ErrUnexpectedEOF) {
+				return false, nil
+			}
+			return false, corrupted("invalid length prefix")
+		}
+		if size > maxBlockSize {
+			return false, corrupted(fmt.Sprintf("invalid block size %d", size))
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			if last {
+				return false, nil
+			}
+			return false, corrupted("truncated block")
+		}
+
+		b, err := Unmarshal(data)
+		if err != nil {
+			return false, corrupted(err.Error())
+		}
+		if r.verify {
+			if reason := verify(*prev, b); reason != "" {
+				return false, corrupted(reason)
+			}
+		}
+		offset += int64(uvarintSize(size)) + int64(size)
+		*prev = b
+
+		num := b.Header.Number
+		if num > to {
+			return true, nil
+		}
+		if num >= from {
+			if err := fn(b); err != nil {
+				return false, err
+			}
+			if num == to {
+				return true, nil
+			}
+		}
+	}
+}
+
+// verify returns the reason if the block doesn't follow the previous block
+func verify(prev, b *common.Block) string {
+	if !bytes.Equal(DataHash(b.Data), b.Header.DataHash) {
+		return "data hash mismatch"
+	}
+	if prev == nil {
+		return ""
+	}
+	if b.Header.Number != prev.Header.Number+1 {
+		return fmt.Sprintf("unexpected block number %d", b.Header.Number)
+	}
+	hash, err := block.GenerateHash(prev)
+	if err != nil {
+		return err.Error()
+	}
+	if !bytes.Equal(hash, b.Header.PreviousHash) {
+		return "previous hash mismatch"
+	}
+	return ""
+}
+
+// Replay handles the blocks from 'from' to 'to' with the handler as if they were delivered
+func (r *Reader) Replay(from, to uint64, handler block.Handler) error {
+	if handler == nil {
+		return errors.New("block handler is nil")
+	}
+	return r.Range(from, to, func(cb *common.Block) error {
+		b, err := block.New(cb)
+		if err != nil {
+			return fmt.Errorf("failed to parse block data: %w", err)
+		}
+		return handler.Handle(b)
+	})
+}
+
+func uvarintSize(v uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], v)
+}
+
+// WithoutVerification skips verifying hashes and block numbers
+func WithoutVerification() Option {
+	return func(r *Reader) error {
+		r.verify = false
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+package channel
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+
+	"github.com/key-inside/patrasche/tx/responsible"
+)
+
+// Executor queries and executes chaincodes, ex) Client and the fake channel of the patrasche/testing package
+type Executor interface {
+	Query(request channel.Request, options ...channel.RequestOption) (channel.Response, error)
+	Execute(request channel.Request, options ...channel.RequestOption) (channel.Response, error)
+}
+
+// Codec marshals chaincode args and unmarshals payloads
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default codec, strings and byte slices are passed as they are
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *string:
+		*v = string(data)
+		return nil
+	case *[]byte:
+		*v = append([]byte{}, data...)
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Request is a chaincode request with Go values, marshaled by the codec
+type Request struct {
+	Chaincode string
+	Fcn       string
+	Args      []interface{}
+	Transient map[string]interface{}
+}
+
+type callParams struct {
+	codec   Codec
+	reqOpts []channel.RequestOption
+}
+
+type CallOption func(*callParams) error
+
+// WithCodec sets the codec of args, transient values and payloads, default is JSONCodec
+func WithCodec(codec Codec) CallOption {
+	return func(p *callParams) error {
+		if codec == nil {
+			return fmt.Errorf("codec is nil")
+		}
+		p.codec = codec
+		return nil
+	}
+}
+
+// WithTargets selects the target peers by URL or name
+func WithTargets(endpoints ...string) CallOption {
+	return func(p *callParams) error {
+		p.reqOpts = append(p.reqOpts, channel.WithTargetEndpoints(endpoints...))
+		return nil
+	}
+}
+
+// WithRequestOptions appends the fabric-sdk-go request options
+func WithRequestOptions(options ...channel.RequestOption) CallOption {
+	return func(p *callParams) error {
+		p.reqOpts = append(p.reqOpts, options...)
+		return nil
+	}
+}
+
+// Query queries the chaincode and decodes the payload into T.
+// A chaincode error is converted into responsible.Error if possible, use errors.As to get it.
+func Query[T any](e Executor, req Request, options ...CallOption) (T, error) {
+	result, _, err := call[T](e.Query, req, options)
+	return result, err
+}
+
+// Invoke executes the chaincode, waits for the commit and decodes the payload into T.
+// A chaincode error is converted into responsible.Error if possible, use errors.As to get it.
+func Invoke[T any](e Executor, req Request, options ...CallOption) (result T, txID string, err error) {
+	return call[T](e.Execute, req, options)
+}
+
+func call[T any](fn func(channel.Request, ...channel.RequestOption) (channel.Response, error), req Request, options []CallOption) (result T, txID string, err error) {
+	p := &callParams{codec: JSONCodec{}}
+	for _, option := range options {
+		if err = option(p); err != nil {
+			return result, "", fmt.Errorf("failed to apply call option: %w", err)
+		}
+	}
+
+	r := channel.Request{ChaincodeID: req.Chaincode, Fcn: req.Fcn}
+	for i, arg := range req.Args {
+		data, err := p.codec.Marshal(arg)
+		if err != nil {
+			return result, "", fmt.Errorf("failed to marshal arg %d: %w", i, err)
+		}
+		r.Args = append(r.Args, data)
+	}
+	if len(req.Transient) > 0 {
+		r.TransientMap = map[string][]byte{}
+		for k, v := range req.Transient {
+			data, err := p.codec.Marshal(v)
+			if err != nil {
+				return result, "", fmt.Errorf("failed to marshal transient %s: %w", k, err)
+			}
+			r.TransientMap[k] = data
+		}
+	}
+
+	res, err := fn(r, p.reqOpts...)
+	if err != nil {
+		if rErr, ok := responsible.From(err); ok {
+			err = rErr
+		}
+		return result, "", fmt.Errorf("chaincode %s %s: %w", req.Chaincode, req.Fcn, err)
+	}
+	txID = string(res.TransactionID)
+	if len(res.Payload) > 0 {
+		if err = p.codec.Unmarshal(res.Payload, &result); err != nil {
+			return result, txID, fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+	}
+	return result, txID, nil
+}
@@ -0,0 +1,57 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+
+	"github.com/key-inside/patrasche/tx/responsible"
+)
+
+type testExecutor func(channel.Request) (channel.Response, error)
+
+func (f testExecutor) Query(request channel.Request, options ...channel.RequestOption) (channel.Response, error) {
+	return f(request)
+}
+
+func (f testExecutor) Execute(request channel.Request, options ...channel.RequestOption) (channel.Response, error) {
+	res, err := f(request)
+	res.TransactionID = "txid"
+	return res, err
+}
+
+type balance struct {
+	Owner  string `json:"owner"`
+	Amount int    `json:"amount"`
+}
+
+func Test_QueryInvoke(t *testing.T) {
+	e := testExecutor(func(req channel.Request) (channel.Response, error) {
+		switch req.Fcn {
+		case "balance":
+			return channel.Response{Payload: []byte(fmt.Sprintf(`{"owner":"%s","amount":%s}`, req.Args[0], req.Args[1]))}, nil
+		case "secret":
+			return channel.Response{Payload: req.TransientMap["key"]}, nil
+		}
+		// like the status error of fabric-sdk-go
+		return channel.Response{}, errors.New(`Transaction processing for endorser [peer0:7051]: Chaincode status Code: (500) UNKNOWN. Description: {"namespace":"token","code":"NOT_FOUND","message":"unknown function"}`)
+	})
+
+	b, err := Query[balance](e, Request{Chaincode: "token", Fcn: "balance", Args: []interface{}{"alice", 10}})
+	if err != nil || b.Owner != "alice" || b.Amount != 10 {
+		t.Errorf("unexpected result: %+v, %v", b, err)
+	}
+
+	s, txID, err := Invoke[string](e, Request{Chaincode: "token", Fcn: "secret", Transient: map[string]interface{}{"key": []byte("xyz")}})
+	if err != nil || s != "xyz" || txID != "txid" {
+		t.Errorf("unexpected result: %s, %s, %v", s, txID, err)
+	}
+
+	_, err = Query[balance](e, Request{Chaincode: "token", Fcn: "mint"})
+	var rErr responsible.Error
+	if !errors.As(err, &rErr) || rErr.Code != "NOT_FOUND" || rErr.Namespace != "token" {
+		t.Errorf("expected responsible error, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package ledger
 import (
 	"fmt"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
@@ -13,6 +14,8 @@ import (
 
 type Client struct {
 	*ledger.Client
+
+	timeCache *blockTimeCache
 }
 
 func New(ctx context.ChannelProvider, options ...ledger.ClientOption) (*Client, error) {
@@ -20,7 +23,7 @@ func New(ctx context.ChannelProvider, options ...ledger.ClientOption) (*Client,
 	if err != nil {
 		return nil, err
 	}
-	return &Client{_client}, nil
+	return &Client{Client: _client, timeCache: newBlockTimeCache()}, nil
 }
 
 func (c *Client) QueryBlock(blockNumber uint64, options ...ledger.RequestOption) (*block.Block, error) {
@@ -65,7 +68,11 @@ func (c *Client) FastQueryTransaction(txID string, options ...ledger.RequestOpti
 	if err != nil {
 		return nil, err
 	}
-	return tx.New(0, 0, byte(pbTx.ValidationCode), pbTx.TransactionEnvelope.Payload)
+	envelope, err := proto.Marshal(pbTx.TransactionEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	return tx.NewFromEnvelope(0, 0, byte(pbTx.ValidationCode), envelope)
 }
 
 type BlockchainInfoResponse struct {
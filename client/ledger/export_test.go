@@ -0,0 +1,47 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+// Ledger is the ledger queries of the time search, ex) the fake channel of the patrasche/testing package
+type Ledger interface {
+	QueryInfo(options ...ledger.RequestOption) (*BlockchainInfoResponse, error)
+	QueryBlock(blockNumber uint64, options ...ledger.RequestOption) (*block.Block, error)
+}
+
+// TimeSearcher exposes the time search to the tests of the ledger_test package,
+// the patrasche/testing package can not be imported by the tests of the ledger package
+type TimeSearcher struct {
+	s *timeSearcher
+}
+
+func NewTimeSearcher(l Ledger) *TimeSearcher {
+	return &TimeSearcher{&timeSearcher{
+		height: func() (uint64, error) {
+			info, err := l.QueryInfo()
+			if err != nil {
+				return 0, err
+			}
+			return info.BCI.Height, nil
+		},
+		query: func(num uint64) (*block.Block, error) { return l.QueryBlock(num) },
+		cache: newBlockTimeCache(),
+	}}
+}
+
+func (s *TimeSearcher) BlockTime(num uint64) (time.Time, error) {
+	return s.s.blockTime(num)
+}
+
+func (s *TimeSearcher) FindBlockByTime(t time.Time) (uint64, error) {
+	return s.s.findBlock(t)
+}
+
+func (s *TimeSearcher) FindLastBlockByTime(t time.Time) (uint64, error) {
+	return s.s.findLastBlock(t)
+}
@@ -0,0 +1,205 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+// CurrentHeight can be used as the 'to' block number of ScanBlocks.
+// It is resolved to the last block number of the chain by QueryInfo.
+const CurrentHeight uint64 = math.MaxUint64
+
+type scanParams struct {
+	workers     int
+	retries     int
+	backoff     time.Duration
+	reqOpts     []ledger.RequestOption
+	onRetryFunc func(blockNum uint64, attempt int, err error)
+}
+
+type ScanOption func(p *scanParams)
+
+// WithScanWorkers sets the number of concurrent block fetchers, default is 4
+func WithScanWorkers(n int) ScanOption {
+	return func(p *scanParams) {
+		p.workers = n
+	}
+}
+
+// WithScanRetry sets the retry count and the initial backoff per block.
+// The backoff doubles on every retry. Default is 3 retries from 500ms.
+func WithScanRetry(retries int, backoff time.Duration) ScanOption {
+	return func(p *scanParams) {
+		p.retries = retries
+		p.backoff = backoff
+	}
+}
+
+// WithScanRequestOptions sets the request options used for querying blocks and info
+func WithScanRequestOptions(options ...ledger.RequestOption) ScanOption {
+	return func(p *scanParams) {
+		p.reqOpts = options
+	}
+}
+
+// WithScanRetryCallback sets the function called before every retry
+func WithScanRetryCallback(f func(blockNum uint64, attempt int, err error)) ScanOption {
+	return func(p *scanParams) {
+		p.onRetryFunc = f
+	}
+}
+
+// ScanBlocks fetches blocks from 'from' to 'to' (inclusive) concurrently
+// and delivers them to the handler in order.
+// If 'to' is CurrentHeight, it is resolved to the last block number by QueryInfo.
+func (c *Client) ScanBlocks(ctx context.Context, from, to uint64, handler block.Handler, options ...ScanOption) error {
+	if handler == nil {
+		return fmt.Errorf("block handler is nil")
+	}
+
+	p := &scanParams{
+		workers: 4,
+		retries: 3,
+		backoff: 500 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(p)
+	}
+
+	if to == CurrentHeight {
+		info, err := c.QueryInfo(p.reqOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to query info: %w", err)
+		}
+		if info.BCI.Height == 0 {
+			return nil
+		}
+		to = info.BCI.Height - 1
+	}
+
+	query := func(num uint64) (*block.Block, error) {
+		return c.QueryBlock(num, p.reqOpts...)
+	}
+	return scanBlocks(ctx, query, from, to, handler, p)
+}
+
+type scanResult struct {
+	num   uint64
+	block *block.Block
+	err   error
+}
+
+func scanBlocks(ctx context.Context, query func(uint64) (*block.Block, error), from, to uint64, handler block.Handler, p *scanParams) error {
+	if from > to {
+		return fmt.Errorf("invalid block range: %d > %d", from, to)
+	}
+	workers := p.workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// window limits the number of fetched but undelivered blocks
+	window := make(chan struct{}, workers*2)
+	jobs := make(chan uint64)
+	results := make(chan scanResult, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := range jobs {
+				b, err := fetchBlock(ctx, query, num, p)
+				select {
+				case results <- scanResult{num: num, block: b, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for num := from; ; num++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- num:
+			case <-ctx.Done():
+				return
+			}
+			if num == to { // avoids overflow when 'to' is MaxUint64
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := map[uint64]*block.Block{}
+	next := from
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				return ctx.Err()
+			}
+			if r.err != nil {
+				return fmt.Errorf("failed to fetch block %d: %w", r.num, r.err)
+			}
+			pending[r.num] = r.block
+			for b, ok := pending[next]; ok; b, ok = pending[next] {
+				delete(pending, next)
+				if err := handler.Handle(b); err != nil {
+					return err
+				}
+				<-window
+				if next == to {
+					return nil
+				}
+				next++
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func fetchBlock(ctx context.Context, query func(uint64) (*block.Block, error), num uint64, p *scanParams) (*block.Block, error) {
+	backoff := p.backoff
+	for attempt := 0; ; attempt++ {
+		b, err := query(num)
+		if err == nil {
+			return b, nil
+		}
+		if attempt >= p.retries {
+			return nil, err
+		}
+		if p.onRetryFunc != nil {
+			p.onRetryFunc(num, attempt+1, err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,64 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+type blockCollector struct {
+	nums []uint64
+}
+
+func (c *blockCollector) Handle(b *block.Block) error {
+	c.nums = append(c.nums, b.Num)
+	return nil
+}
+
+func Test_ScanBlocksInOrder(t *testing.T) {
+	var failed int32
+	query := func(num uint64) (*block.Block, error) {
+		// fails once per block to exercise retries and reorders completions
+		if num%3 == 0 && atomic.AddInt32(&failed, 1)%2 == 1 {
+			return nil, errors.New("transient")
+		}
+		time.Sleep(time.Duration(10-num%10) * time.Millisecond)
+		return &block.Block{Num: num}, nil
+	}
+	p := &scanParams{workers: 4, retries: 3, backoff: time.Millisecond}
+
+	c := &blockCollector{}
+	if err := scanBlocks(context.Background(), query, 5, 40, c, p); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(c.nums) != 36 {
+		t.Fatalf("expected 36 blocks, got %d", len(c.nums))
+	}
+	for i, n := range c.nums {
+		if n != uint64(5+i) {
+			t.Fatalf("out of order at %d: %d", i, n)
+		}
+	}
+}
+
+func Test_ScanBlocksRetryExhausted(t *testing.T) {
+	query := func(num uint64) (*block.Block, error) {
+		if num == 7 {
+			return nil, errors.New("permanent")
+		}
+		return &block.Block{Num: num}, nil
+	}
+	p := &scanParams{workers: 2, retries: 1, backoff: time.Millisecond}
+
+	c := &blockCollector{}
+	if err := scanBlocks(context.Background(), query, 0, 20, c, p); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(c.nums) != 7 {
+		t.Errorf("expected blocks 0-6 delivered, got %v", c.nums)
+	}
+}
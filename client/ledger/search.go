@@ -0,0 +1,170 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/tx"
+)
+
+var ErrBlockNotFound = errors.New("block not found")
+
+// maximum number of cached block timestamps
+const blockTimeCacheSize = 4096
+
+type blockTimeCache struct {
+	mutex sync.Mutex
+	times map[uint64]time.Time
+}
+
+func newBlockTimeCache() *blockTimeCache {
+	return &blockTimeCache{times: map[uint64]time.Time{}}
+}
+
+func (c *blockTimeCache) get(num uint64) (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	t, ok := c.times[num]
+	return t, ok
+}
+
+func (c *blockTimeCache) put(num uint64, t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.times) >= blockTimeCacheSize {
+		c.times = map[uint64]time.Time{}
+	}
+	c.times[num] = t
+}
+
+// BlockTime returns the block timestamp (see block.Block.Timestamp).
+// A block without transactions has the zero time.
+func (c *Client) BlockTime(blockNumber uint64, options ...ledger.RequestOption) (time.Time, error) {
+	return c.searcher(options...).blockTime(blockNumber)
+}
+
+// FindBlockByTime returns the number of the first block whose timestamp is equal to or later than t.
+// Since transaction timestamps are set by clients, the result is approximate if they are not monotonic.
+func (c *Client) FindBlockByTime(t time.Time, options ...ledger.RequestOption) (uint64, error) {
+	return c.searcher(options...).findBlock(t)
+}
+
+// FindLastBlockByTime returns the number of the last block whose timestamp is equal to or earlier than t.
+func (c *Client) FindLastBlockByTime(t time.Time, options ...ledger.RequestOption) (uint64, error) {
+	return c.searcher(options...).findLastBlock(t)
+}
+
+// FindTransactionByTime returns the first transaction whose timestamp is equal to or later than t.
+func (c *Client) FindTransactionByTime(t time.Time, options ...ledger.RequestOption) (*tx.Tx, error) {
+	num, err := c.FindBlockByTime(t, options...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.QueryBlock(num, options...)
+	if err != nil {
+		return nil, err
+	}
+	for _, bt := range b.Txs {
+		if !bt.Timestamp().UTC().Before(t) {
+			return bt, nil
+		}
+	}
+	return nil, fmt.Errorf("tx disappeared") // never here
+}
+
+func (c *Client) searcher(options ...ledger.RequestOption) *timeSearcher {
+	return &timeSearcher{
+		height: func() (uint64, error) {
+			info, err := c.QueryInfo(options...)
+			if err != nil {
+				return 0, fmt.Errorf("failed to query info: %w", err)
+			}
+			return info.BCI.Height, nil
+		},
+		query: func(num uint64) (*block.Block, error) {
+			return c.QueryBlock(num, options...)
+		},
+		cache: c.timeCache,
+	}
+}
+
+// timeSearcher binary-searches blocks by timestamp over the ledger queries
+type timeSearcher struct {
+	height func() (uint64, error)
+	query  func(uint64) (*block.Block, error)
+	cache  *blockTimeCache // nil to disable
+}
+
+func (s *timeSearcher) blockTime(num uint64) (time.Time, error) {
+	if s.cache != nil {
+		if t, ok := s.cache.get(num); ok {
+			return t, nil
+		}
+	}
+	b, err := s.query(num)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var t time.Time
+	if ts := b.Timestamp(); ts != nil {
+		t = ts.UTC()
+	}
+	if s.cache != nil {
+		s.cache.put(num, t)
+	}
+	return t, nil
+}
+
+func (s *timeSearcher) findBlock(t time.Time) (uint64, error) {
+	height, err := s.height()
+	if err != nil {
+		return 0, err
+	}
+	num, err := s.search(height, func(bt time.Time) bool { return !bt.Before(t) })
+	if err != nil {
+		return 0, err
+	}
+	if num >= height {
+		return 0, fmt.Errorf("no block at or after %s: %w", t.UTC().Format(time.RFC3339Nano), ErrBlockNotFound)
+	}
+	return num, nil
+}
+
+func (s *timeSearcher) findLastBlock(t time.Time) (uint64, error) {
+	height, err := s.height()
+	if err != nil {
+		return 0, err
+	}
+	num, err := s.search(height, func(bt time.Time) bool { return bt.After(t) })
+	if err != nil {
+		return 0, err
+	}
+	if num == 0 {
+		return 0, fmt.Errorf("no block at or before %s: %w", t.UTC().Format(time.RFC3339Nano), ErrBlockNotFound)
+	}
+	return num - 1, nil
+}
+
+// search returns the smallest block number in [0, height) for which f is true, or height.
+// f must be false and then true over the block timestamps.
+func (s *timeSearcher) search(height uint64, f func(time.Time) bool) (uint64, error) {
+	lo, hi := uint64(0), height
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		bt, err := s.blockTime(mid)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get block %d time: %w", mid, err)
+		}
+		if f(bt) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
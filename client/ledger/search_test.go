@@ -0,0 +1,92 @@
+package ledger_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+
+	"github.com/key-inside/patrasche/block"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+	ptesting "github.com/key-inside/patrasche/testing"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+// countingLedger counts the block queries to check the block time cache
+type countingLedger struct {
+	*ptesting.Channel
+	queries int
+}
+
+func (l *countingLedger) QueryBlock(blockNumber uint64, options ...ledger.RequestOption) (*block.Block, error) {
+	l.queries++
+	return l.Channel.QueryBlock(blockNumber, options...)
+}
+
+func Test_FindBlockByTime(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{t0, t0.Add(time.Minute), t0.Add(time.Minute), t0.Add(time.Minute), t0.Add(2 * time.Minute), t0.Add(3 * time.Minute)}
+	blocks := []*blocktest.Block{}
+	for i, bt := range times {
+		blocks = append(blocks, blocktest.NewBlock(uint64(i)).WithTime(bt).AddEndorserTx("token", "mint").Block())
+	}
+	ch := ptesting.NewChannel()
+	if err := ch.AddBlocks(blocktest.Chain(blocks...)...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	l := &countingLedger{Channel: ch}
+	s := ldgclient.NewTimeSearcher(l)
+
+	const notFound = -1
+	tests := []struct {
+		name  string
+		t     time.Time
+		first int
+		last  int
+	}{
+		{"before first", t0.Add(-time.Second), 0, notFound},
+		{"first", t0, 0, 0},
+		{"equal timestamps", t0.Add(time.Minute), 1, 3},
+		{"between", t0.Add(90 * time.Second), 4, 3},
+		{"last", t0.Add(3 * time.Minute), 5, 5},
+		{"after last", t0.Add(time.Hour), notFound, 5},
+	}
+	for _, tt := range tests {
+		first, err := s.FindBlockByTime(tt.t)
+		if tt.first == notFound {
+			if !errors.Is(err, ldgclient.ErrBlockNotFound) {
+				t.Errorf("%s: expected ErrBlockNotFound, got %d, %v", tt.name, first, err)
+			}
+		} else if err != nil || first != uint64(tt.first) {
+			t.Errorf("%s: expected first block %d, got %d, %v", tt.name, tt.first, first, err)
+		}
+
+		last, err := s.FindLastBlockByTime(tt.t)
+		if tt.last == notFound {
+			if !errors.Is(err, ldgclient.ErrBlockNotFound) {
+				t.Errorf("%s: expected ErrBlockNotFound, got %d, %v", tt.name, last, err)
+			}
+		} else if err != nil || last != uint64(tt.last) {
+			t.Errorf("%s: expected last block %d, got %d, %v", tt.name, tt.last, last, err)
+		}
+	}
+
+	// all probed block times are cached
+	l.queries = 0
+	s.FindBlockByTime(t0.Add(time.Minute))
+	if l.queries != 0 {
+		t.Errorf("expected cached block times, got %d queries", l.queries)
+	}
+	if bt, err := s.BlockTime(2); err != nil || !bt.Equal(times[2]) {
+		t.Errorf("unexpected block time: %v, %v", bt, err)
+	}
+
+	empty := ldgclient.NewTimeSearcher(ptesting.NewChannel())
+	if _, err := empty.FindBlockByTime(t0); !errors.Is(err, ldgclient.ErrBlockNotFound) {
+		t.Errorf("empty chain: expected ErrBlockNotFound, got %v", err)
+	}
+	if _, err := empty.FindLastBlockByTime(t0); !errors.Is(err, ldgclient.ErrBlockNotFound) {
+		t.Errorf("empty chain: expected ErrBlockNotFound, got %v", err)
+	}
+}
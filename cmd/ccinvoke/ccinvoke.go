@@ -0,0 +1,197 @@
+package ccinvoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	fabch "github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/output"
+	"github.com/key-inside/patrasche/tx/responsible"
+)
+
+var once sync.Once
+
+var cmd *cobra.Command
+
+func Command() *cobra.Command {
+	once.Do(func() {
+		v := viper.New()
+		cmd = &cobra.Command{
+			Use:   "cci",
+			Short: "Chaincode invoke",
+			Long:  "Invoking chaincode function submits a transaction and waits for the commit",
+			Run: func(cmd *cobra.Command, args []string) {
+				p := patrasche.Biter(cmd)
+				logger := p.Logger().With().Str("caller", "cci").Logger()
+
+				req, err := request(v)
+				if err != nil {
+					logger.Error().Err(err).Send()
+					return
+				}
+
+				ch, err := p.NewChannel()
+				if err != nil {
+					logger.Error().Err(err).Send()
+					return
+				}
+				defer ch.Close()
+
+				client, err := ch.NewClient()
+				if err != nil {
+					logger.Error().Err(err).Send()
+					return
+				}
+
+				opts := []fabch.RequestOption{}
+				if targets := v.GetStringSlice("targets"); len(targets) > 0 {
+					opts = append(opts, fabch.WithTargetEndpoints(targets...))
+				}
+				if orgs := v.GetStringSlice("orgs"); len(orgs) > 0 {
+					opts = append(opts, fabch.WithTargetFilter(mspFilter(orgs)))
+				}
+
+				res, err := client.Execute(req, opts...)
+				if err != nil {
+					if rErr, ok := responsible.From(err); ok {
+						if pr := p.Printer(); pr != nil {
+							pr.Print(rErr)
+						}
+						causes, _ := json.MarshalIndent(rErr.Causes, "", "  ")
+						logger.Error().
+							Str("namespace", rErr.Namespace).
+							Str("code", rErr.Code).
+							Str("message", rErr.Message).
+							RawJSON("causes", causes).
+							Msg("chaincode error")
+						return
+					}
+					logger.Error().Err(err).Send()
+					return
+				}
+
+				r := result{
+					TxID:           string(res.TransactionID),
+					ValidationCode: res.TxValidationCode.String(),
+					Payload:        output.Payload(res.Payload),
+				}
+				if ldgClient, err := ch.NewLedgerClient(); err == nil {
+					if b, err := ldgClient.QueryBlockByTxID(r.TxID); err == nil {
+						r.BlockNum = &b.Num
+					} else {
+						logger.Warn().Err(err).Msg("failed to query the block of the transaction")
+					}
+				}
+				if pr := p.Printer(); pr != nil {
+					if err := pr.Print(r); err != nil {
+						logger.Error().Err(err).Send()
+					}
+					return
+				}
+				event := logger.Info().
+					Str("tx_id", r.TxID).
+					Str("validation_code", r.ValidationCode).
+					Str("payload", string(res.Payload))
+				if r.BlockNum != nil {
+					event = event.Uint64("block_number", *r.BlockNum)
+				}
+				event.Msg("invoke success")
+			},
+		}
+
+		flags := cmd.Flags()
+		flags.String("cc", "", "chaincode name")
+		flags.String("fn", "", "function name")
+		flags.StringArray("args", []string{}, "arguments")
+		flags.String("args-file", "", "JSON array file of arguments, they precede --args")
+		flags.StringArray("transient", []string{}, "transient data, key=value or key=@file")
+		flags.StringSlice("targets", []string{}, "target peer URLs or names")
+		flags.StringSlice("orgs", []string{}, "MSP IDs of endorsing organizations")
+
+		v.BindPFlags(flags)
+	})
+
+	return cmd
+}
+
+// result is the output of the command
+type result struct {
+	TxID           string      `json:"tx_id"`
+	ValidationCode string      `json:"validation_code"`
+	BlockNum       *uint64     `json:"block_num,omitempty"`
+	Payload        interface{} `json:"payload"`
+}
+
+// request builds the chaincode request from the flags
+func request(v *viper.Viper) (fabch.Request, error) {
+	req := fabch.Request{
+		ChaincodeID: v.GetString("cc"),
+		Fcn:         v.GetString("fn"),
+		Args:        [][]byte{},
+	}
+	if req.ChaincodeID == "" || req.Fcn == "" {
+		return req, fmt.Errorf("cc and fn are required")
+	}
+
+	if path := v.GetString("args-file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return req, fmt.Errorf("failed to read args file: %w", err)
+		}
+		var fileArgs []json.RawMessage
+		if err := json.Unmarshal(data, &fileArgs); err != nil {
+			return req, fmt.Errorf("args file must be a JSON array: %w", err)
+		}
+		for _, arg := range fileArgs {
+			var s string
+			if json.Unmarshal(arg, &s) == nil {
+				req.Args = append(req.Args, []byte(s))
+			} else {
+				req.Args = append(req.Args, arg) // objects, arrays and numbers as JSON text
+			}
+		}
+	}
+	for _, arg := range v.GetStringSlice("args") {
+		req.Args = append(req.Args, []byte(arg))
+	}
+
+	for _, kv := range v.GetStringSlice("transient") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return req, fmt.Errorf("invalid transient: %s", kv)
+		}
+		if req.TransientMap == nil {
+			req.TransientMap = map[string][]byte{}
+		}
+		if strings.HasPrefix(value, "@") {
+			data, err := os.ReadFile(value[1:])
+			if err != nil {
+				return req, fmt.Errorf("failed to read transient file: %w", err)
+			}
+			req.TransientMap[key] = data
+		} else {
+			req.TransientMap[key] = []byte(value)
+		}
+	}
+	return req, nil
+}
+
+// mspFilter accepts the peers of the MSP IDs
+type mspFilter []string
+
+func (f mspFilter) Accept(peer fab.Peer) bool {
+	for _, id := range f {
+		if peer.MSPID() == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package ccinvoke
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func Test_Request(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args.json")
+	os.WriteFile(argsFile, []byte(`["transfer", {"amount": 10}, [1, 2], 3]`), 0644)
+	badArgsFile := filepath.Join(dir, "bad.json")
+	os.WriteFile(badArgsFile, []byte(`{"not": "array"}`), 0644)
+	secretFile := filepath.Join(dir, "secret.bin")
+	os.WriteFile(secretFile, []byte{0x00, 0x01}, 0644)
+
+	cases := []struct {
+		name      string
+		values    map[string]interface{}
+		args      [][]byte
+		transient map[string][]byte
+		err       bool
+	}{
+		{
+			name:   "args",
+			values: map[string]interface{}{"args": []string{"alice", "10"}},
+			args:   [][]byte{[]byte("alice"), []byte("10")},
+		},
+		{
+			name:   "args file precedes args",
+			values: map[string]interface{}{"args-file": argsFile, "args": []string{"bob"}},
+			args:   [][]byte{[]byte("transfer"), []byte(`{"amount": 10}`), []byte("[1, 2]"), []byte("3"), []byte("bob")},
+		},
+		{
+			name:   "args file not an array",
+			values: map[string]interface{}{"args-file": badArgsFile},
+			err:    true,
+		},
+		{
+			name:   "args file not found",
+			values: map[string]interface{}{"args-file": filepath.Join(dir, "none.json")},
+			err:    true,
+		},
+		{
+			name:      "transient",
+			values:    map[string]interface{}{"transient": []string{"price=100", "secret=@" + secretFile, "empty="}},
+			args:      [][]byte{},
+			transient: map[string][]byte{"price": []byte("100"), "secret": {0x00, 0x01}, "empty": {}},
+		},
+		{
+			name:   "transient file not found",
+			values: map[string]interface{}{"transient": []string{"secret=@" + filepath.Join(dir, "none.bin")}},
+			err:    true,
+		},
+		{
+			name:   "transient without value",
+			values: map[string]interface{}{"transient": []string{"price"}},
+			err:    true,
+		},
+		{
+			name:   "transient without key",
+			values: map[string]interface{}{"transient": []string{"=100"}},
+			err:    true,
+		},
+		{
+			name:   "no fn",
+			values: map[string]interface{}{"fn": ""},
+			err:    true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := viper.New()
+			v.Set("cc", "token")
+			v.Set("fn", "invoke")
+			for key, value := range c.values {
+				v.Set(key, value)
+			}
+
+			req, err := request(v)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected error, got %+v", req)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if req.ChaincodeID != "token" || req.Fcn != "invoke" {
+				t.Errorf("unexpected chaincode: %s.%s", req.ChaincodeID, req.Fcn)
+			}
+			if !reflect.DeepEqual(req.Args, c.args) {
+				t.Errorf("expected args %q, got %q", c.args, req.Args)
+			}
+			if !reflect.DeepEqual(req.TransientMap, c.transient) {
+				t.Errorf("expected transient %q, got %q", c.transient, req.TransientMap)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/output"
 )
 
 var once sync.Once
@@ -16,6 +17,7 @@ var cmd *cobra.Command
 
 func Command() *cobra.Command {
 	once.Do(func() {
+		v := viper.New()
 		cmd = &cobra.Command{
 			Use:   "ccq",
 			Short: "Chaincode query",
@@ -38,13 +40,13 @@ func Command() *cobra.Command {
 				}
 
 				reqArgs := [][]byte{}
-				for _, arg := range viper.GetStringSlice("args") {
+				for _, arg := range v.GetStringSlice("args") {
 					reqArgs = append(reqArgs, []byte(arg))
 				}
 
 				req := fabch.Request{
-					ChaincodeID: viper.GetString("cc"),
-					Fcn:         viper.GetString("fn"),
+					ChaincodeID: v.GetString("cc"),
+					Fcn:         v.GetString("fn"),
 					Args:        reqArgs,
 				}
 				res, err := client.Query(req)
@@ -52,6 +54,12 @@ func Command() *cobra.Command {
 					logger.Error().Err(err).Send()
 					return
 				}
+				if pr := p.Printer(); pr != nil {
+					if err := pr.Print(output.Payload(res.Payload)); err != nil {
+						logger.Error().Err(err).Send()
+					}
+					return
+				}
 				logger.Info().Str("payload", string(res.Payload)).Msg("query success")
 			},
 		}
@@ -61,7 +69,7 @@ func Command() *cobra.Command {
 		flags.String("fn", "", "function name")
 		flags.StringArray("args", []string{}, "arguments")
 
-		viper.BindPFlags(flags)
+		v.BindPFlags(flags)
 	})
 
 	return cmd
@@ -1,16 +1,23 @@
 package inspect
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/hyperledger/fabric-protos-go/common"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/archive"
 	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/blockfile"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
 	"github.com/key-inside/patrasche/listener"
+	"github.com/key-inside/patrasche/schema"
 	"github.com/key-inside/patrasche/tx"
 )
 
@@ -20,6 +27,7 @@ var cmd *cobra.Command
 
 func Command() *cobra.Command {
 	once.Do(func() {
+		v := viper.New() // command-local, flag names like start are used by other commands too
 		cmd = &cobra.Command{
 			Use:     "inspect",
 			Short:   "Inspect transactions",
@@ -29,30 +37,32 @@ func Command() *cobra.Command {
 				p := patrasche.Biter(cmd)
 				logger := p.Logger().With().Str("caller", "inspect").Logger()
 
-				// inspect tx handler
-				txHandler := NewTxHandler(logger)
-				// tx filters
-				if pattern := viper.GetString("filter.tx-hash"); pattern != "" {
-					txHandler = tx.NewHashFilter(txHandler, pattern, tx.NewHashFilteredLoggingAction(&logger))
+				// tx pipeline, top-down
+				txMws := []tx.Middleware{tx.StdLogger(&logger)} // logging middleware
+				if v.GetBool("filter.valid-endorser") {
+					txMws = append(txMws, tx.ValidEndorserFilter(tx.NewValidEndorserFilteredLoggingAction(&logger)))
 				}
-				if viper.GetBool("filter.valid-endorser") {
-					txHandler = tx.NewValidEndorserFilter(txHandler, tx.NewValidEndorserFilteredLoggingAction(&logger))
+				if pattern := v.GetString("filter.tx-hash"); pattern != "" {
+					txMws = append(txMws, tx.HashFilter(pattern, tx.NewHashFilteredLoggingAction(&logger)))
 				}
-				// logging middleware
-				txHandler = tx.NewStdLogger(txHandler, &logger)
+				var finalTxHandler tx.Handler = NewTxHandler(logger) // inspect tx handler
+				if pr := p.Printer(); pr != nil {
+					finalTxHandler = tx.HandlerFunc(func(t *tx.Tx) error {
+						st, err := schema.NewTx(t)
+						if err != nil {
+							return err
+						}
+						return pr.Print(st)
+					})
+				}
+				txHandler := tx.Chain(finalTxHandler, txMws...)
 
 				// standard block handler
-				blockHandler, err := block.NewStdHandler(txHandler)
+				stdHandler, err := block.NewStdHandler(txHandler)
 				if err != nil {
 					logger.Error().Err(err).Msg("")
 					return
 				}
-				// block filter
-				if pattern := viper.GetString("filter.block-hash"); pattern != "" {
-					blockHandler = block.NewHashFilter(blockHandler, pattern, block.NewHashFilteredLoggingAction(&logger))
-				}
-				// logging middleware
-				blockHandler = block.NewStdLogger(blockHandler, &logger)
 
 				// listener options
 				opts := []listener.Option{
@@ -60,23 +70,113 @@ func Command() *cobra.Command {
 						logger.Info().Str("signal", sig.String()).Msg("shutting down...")
 					}),
 				}
+
+				// block pipeline, top-down
+				blockMws := []block.Middleware{}
 				var startBn uint64
-				if path := viper.GetString("save"); path != "" {
+				if path := v.GetString("save"); path != "" {
 					nb, _ := os.ReadFile(path)
 					startBn, _ = strconv.ParseUint(string(nb), 10, 64)
 					opts = append(opts, listener.WithStartBlock(startBn))
-					blockHandler = block.NewBlockNumberFileWriter(blockHandler, path) // save block number before block filtering
+					blockMws = append(blockMws, block.BlockNumberFileWriter(path)) // save block number before block filtering
+				}
+				blockMws = append(blockMws, block.StdLogger(&logger)) // logging middleware
+				if pattern := v.GetString("filter.block-hash"); pattern != "" {
+					blockMws = append(blockMws, block.HashFilter(pattern, block.NewHashFilteredLoggingAction(&logger)))
+				}
+				blockHandler := block.Chain(stdHandler, blockMws...)
+
+				// block source, the channel if nil
+				var source listener.BlockSource
+				findBlock := func(t time.Time) (uint64, error) { return findBlockByTime(p, t, false) }
+				findLastBlock := func(t time.Time) (uint64, error) { return findBlockByTime(p, t, true) }
+				if path := v.GetString("archive"); path != "" { // offline
+					r, err := archive.OpenFile(path)
+					if err != nil {
+						logger.Error().Err(err).Send()
+						return
+					}
+					defer r.Close()
+					source, findBlock, findLastBlock = listener.NewRangeSource(r), r.FindBlockByTime, r.FindLastBlockByTime
+				} else if dir := v.GetString("blockfiles"); dir != "" { // offline
+					r, err := blockfile.Open(dir)
+					if err != nil {
+						logger.Error().Err(err).Send()
+						return
+					}
+					source = listener.NewRangeSource(r)
+					findBlock = func(t time.Time) (uint64, error) { return scanBlockByTime(r, t, false) }
+					findLastBlock = func(t time.Time) (uint64, error) { return scanBlockByTime(r, t, true) }
 				}
-				if viper.IsSet("start") {
-					bn := viper.GetUint64("start")
+
+				if v.IsSet("start") {
+					bn := v.GetUint64("start")
 					if startBn <= bn {
 						opts = append(opts, listener.WithStartBlock(bn)) // it will override previous WithStartBlock value
 					}
 				}
-				if viper.IsSet("end") {
-					opts = append(opts, listener.WithEndBlock(viper.GetUint64("end")))
+				if v.IsSet("end") {
+					opts = append(opts, listener.WithEndBlock(v.GetUint64("end")))
+				}
+				if v.IsSet("start-time") {
+					timeOpts, err := resolveStartTime(v.GetString("start-time"), findBlock, startBn)
+					if err != nil {
+						logger.Error().Err(err).Msg("")
+						return
+					}
+					opts = append(opts, timeOpts...)
+				}
+				if str := v.GetString("end-time"); str != "" {
+					t, err := time.Parse(time.RFC3339Nano, str)
+					if err != nil {
+						logger.Error().Err(err).Msg("invalid end-time")
+						return
+					}
+					bn, err := findLastBlock(t)
+					if err != nil {
+						logger.Error().Err(err).Send()
+						return
+					}
+					opts = append(opts, listener.WithEndBlock(bn))
 				}
+				if str := v.GetString("stop-time"); str != "" {
+					t, err := time.Parse(time.RFC3339Nano, str)
+					if err != nil {
+						logger.Error().Err(err).Msg("invalid stop-time")
+						return
+					}
+					opts = append(opts, listener.WithBlockTimeLimit(t))
+				}
+				if d := v.GetDuration("duration"); d > 0 {
+					opts = append(opts, listener.WithDeadline(time.Now().Add(d)))
+				}
+				if n := v.GetUint64("max-blocks"); n > 0 {
+					opts = append(opts, listener.WithMaxBlocks(n))
+				}
+				if n := v.GetUint64("max-txs"); n > 0 {
+					opts = append(opts, listener.WithMaxTxs(n))
+				}
+				if v.GetBool("until-height") {
+					opts = append(opts, listener.WithStopAtHeight())
+				}
+				if d := v.GetDuration("lag-interval"); d > 0 {
+					opts = append(opts, listener.WithLagReport(d, nil), listener.WithLogger(&logger))
+				}
+				opts = append(opts, listener.WithStop(func(reason listener.StopReason) {
+					logger.Info().Stringer("reason", reason).Msg("listener stopped")
+				}))
 
+				if source != nil {
+					l, err := listener.New(source, blockHandler, opts...)
+					if err != nil {
+						logger.Error().Err(err).Msg("")
+						return
+					}
+					if err := l.Listen(); err != nil {
+						logger.Error().Err(err).Msg("")
+					}
+					return
+				}
 				if err := p.ListenBlock(blockHandler, opts...); err != nil {
 					logger.Error().Err(err).Msg("")
 					return
@@ -107,12 +207,93 @@ func Command() *cobra.Command {
 		flags.String("save", "", "block number save file path")
 		flags.Uint64("start", 0, "start block number, if not set, seek from newest")
 		flags.Uint64("end", 0, "end block number")
+		flags.String("start-time", "", "start time (RFC3339), resolved to the first block at or after it")
+		flags.String("end-time", "", "end time (RFC3339), resolved to the last block at or before it")
+		flags.String("stop-time", "", "stop time (RFC3339), stops when a block timestamp passes it")
+		flags.Duration("duration", 0, "stops after the duration")
+		flags.Uint64("max-blocks", 0, "stops after handling the number of blocks")
+		flags.Uint64("max-txs", 0, "stops after handling the number of transactions")
+		flags.Bool("until-height", false, "stops when caught up with the chain height at start")
+		flags.Duration("lag-interval", 0, "interval of lag reports, 0 is disabled")
+		flags.String("archive", "", "archive file path, inspects the archive instead of the channel")
+		flags.String("blockfiles", "", "peer block files directory, inspects the block files instead of the channel")
 		flags.Bool("filter.valid-endorser", false, "valid endorser tx only")
 		flags.String("filter.block-hash", "", "block hash pattern")
 		flags.String("filter.tx-hash", "", "tx hash pattern")
 
-		viper.BindPFlags(flags)
+		v.BindPFlags(flags)
 	})
 
 	return cmd
 }
+
+// resolveStartTime converts the start-time flag to listener options
+func resolveStartTime(startTime string, findBlock func(time.Time) (uint64, error), savedBn uint64) ([]listener.Option, error) {
+	t, err := time.Parse(time.RFC3339Nano, startTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start-time: %w", err)
+	}
+	bn, err := findBlock(t)
+	if err != nil {
+		return nil, err
+	}
+	if savedBn > bn {
+		return nil, nil
+	}
+	return []listener.Option{listener.WithStartBlock(bn)}, nil
+}
+
+// findBlockByTime finds the first block at or after t, or the last block at or before t if last,
+// by the ledger client of the channel
+func findBlockByTime(p *patrasche.Patrasche, t time.Time, last bool) (uint64, error) {
+	ch, err := p.NewChannel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect channel: %w", err)
+	}
+	defer ch.Close()
+
+	client, err := ch.NewLedgerClient()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create ledger client: %w", err)
+	}
+	if last {
+		return client.FindLastBlockByTime(t)
+	}
+	return client.FindBlockByTime(t)
+}
+
+// scanBlockByTime finds the first block at or after t, or the last block at or before t if last,
+// by scanning the block files, they have no time index
+func scanBlockByTime(r *blockfile.Reader, t time.Time, last bool) (uint64, error) {
+	found := false
+	var bn uint64
+	err := r.Range(0, archive.All, func(cb *common.Block) error {
+		b, err := block.New(cb)
+		if err != nil {
+			return fmt.Errorf("failed to parse block data: %w", err)
+		}
+		ts := b.Timestamp()
+		if ts == nil {
+			return nil
+		}
+		if last {
+			if ts.UTC().After(t) {
+				return archive.ErrStop
+			}
+			found, bn = true, b.Num
+			return nil
+		}
+		if !ts.UTC().Before(t) {
+			found, bn = true, b.Num
+			return archive.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, ldgclient.ErrBlockNotFound
+	}
+	return bn, nil
+}
@@ -0,0 +1,246 @@
+package ledger
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/block"
+)
+
+func configCommand(pflags *pflag.FlagSet) *cobra.Command {
+	v := viper.New()
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Query Channel Config",
+		Long:  "Querying the organizations, MSP IDs, anchor peers, orderers and versions from the latest config block",
+		Run: func(cmd *cobra.Command, args []string) {
+			p := patrasche.Biter(cmd)
+			logger := p.Logger().With().Str("caller", "ldg config").Logger()
+
+			client, closeSource, err := openSource(p, v)
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+			defer closeSource()
+
+			b, err := client.ConfigBlock()
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+
+			if path := v.GetString("raw"); path != "" {
+				data, err := proto.Marshal(b.Block)
+				if err == nil {
+					err = os.WriteFile(path, data, 0644)
+				}
+				if err != nil {
+					logger.Error().Err(err).Msg("failed to write config block")
+					return
+				}
+				logger.Info().Uint64("block_num", b.Num).Str("path", path).Msg("config block written")
+				return
+			}
+
+			cfg, err := decodeConfig(b)
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+			printResult(p, &logger, "config", cfg)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.String("raw", "", "file path to write the raw config block (protobuf) instead of decoding it")
+
+	v.BindPFlags(flags)
+	v.BindPFlags(pflags)
+
+	return cmd
+}
+
+type channelConfig struct {
+	Channel      string              `json:"channel"`
+	BlockNum     uint64              `json:"block_num"`
+	Sequence     uint64              `json:"sequence"`
+	Orgs         []orgConfig         `json:"orgs"`
+	Orderers     []string            `json:"orderers,omitempty"` // global orderer addresses
+	Consensus    string              `json:"consensus,omitempty"`
+	Capabilities map[string][]string `json:"capabilities"` // by group
+	Versions     map[string]uint64   `json:"versions"`     // by group path, ex) Channel/Application/Org1
+}
+
+type orgConfig struct {
+	Name        string   `json:"name"`
+	MSPID       string   `json:"mspid"`
+	Role        string   `json:"role"`                   // application or orderer
+	AnchorPeers []string `json:"anchor_peers,omitempty"` // host:port
+	Endpoints   []string `json:"endpoints,omitempty"`    // orderer endpoints of the org
+}
+
+// decodeConfig decodes the config envelope of the config block
+func decodeConfig(b *block.Block) (*channelConfig, error) {
+	if b.Block == nil || b.Data == nil || len(b.Data.Data) == 0 {
+		return nil, fmt.Errorf("block %d has no data", b.Num)
+	}
+	env := &common.Envelope{}
+	if err := proto.Unmarshal(b.Data.Data[0], env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal envelope: %w", err)
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.Payload, payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	if payload.Header == nil {
+		return nil, fmt.Errorf("block %d has no header", b.Num)
+	}
+	chdr := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, chdr); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal channel header: %w", err)
+	}
+	if chdr.Type != int32(common.HeaderType_CONFIG) {
+		return nil, fmt.Errorf("block %d is not a config block", b.Num)
+	}
+	cfgEnv := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, cfgEnv); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config envelope: %w", err)
+	}
+	if cfgEnv.Config == nil || cfgEnv.Config.ChannelGroup == nil {
+		return nil, fmt.Errorf("block %d has no config", b.Num)
+	}
+
+	root := cfgEnv.Config.ChannelGroup
+	cfg := &channelConfig{
+		Channel:      chdr.ChannelId,
+		BlockNum:     b.Num,
+		Sequence:     cfgEnv.Config.Sequence,
+		Orgs:         []orgConfig{},
+		Capabilities: map[string][]string{},
+		Versions:     map[string]uint64{},
+	}
+	collectVersions("Channel", root, cfg.Versions)
+
+	addresses := &common.OrdererAddresses{}
+	if ok, err := configValue(root, "OrdererAddresses", addresses); err != nil {
+		return nil, err
+	} else if ok {
+		cfg.Orderers = addresses.Addresses
+	}
+	if err := collectCapabilities("Channel", root, cfg.Capabilities); err != nil {
+		return nil, err
+	}
+
+	if app := root.Groups["Application"]; app != nil {
+		if err := collectCapabilities("Application", app, cfg.Capabilities); err != nil {
+			return nil, err
+		}
+		for _, name := range sortedKeys(app.Groups) {
+			org, err := decodeOrg(name, "application", app.Groups[name])
+			if err != nil {
+				return nil, err
+			}
+			cfg.Orgs = append(cfg.Orgs, *org)
+		}
+	}
+	if ord := root.Groups["Orderer"]; ord != nil {
+		if err := collectCapabilities("Orderer", ord, cfg.Capabilities); err != nil {
+			return nil, err
+		}
+		consensus := &orderer.ConsensusType{}
+		if ok, err := configValue(ord, "ConsensusType", consensus); err != nil {
+			return nil, err
+		} else if ok {
+			cfg.Consensus = consensus.Type
+		}
+		for _, name := range sortedKeys(ord.Groups) {
+			org, err := decodeOrg(name, "orderer", ord.Groups[name])
+			if err != nil {
+				return nil, err
+			}
+			cfg.Orgs = append(cfg.Orgs, *org)
+		}
+	}
+	return cfg, nil
+}
+
+func decodeOrg(name, role string, g *common.ConfigGroup) (*orgConfig, error) {
+	org := &orgConfig{Name: name, Role: role}
+
+	mspCfg := &msp.MSPConfig{}
+	if ok, err := configValue(g, "MSP", mspCfg); err != nil {
+		return nil, err
+	} else if ok {
+		fabricCfg := &msp.FabricMSPConfig{}
+		if err := proto.Unmarshal(mspCfg.Config, fabricCfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal MSP config of %s: %w", name, err)
+		}
+		org.MSPID = fabricCfg.Name
+	}
+
+	anchors := &peer.AnchorPeers{}
+	if ok, err := configValue(g, "AnchorPeers", anchors); err != nil {
+		return nil, err
+	} else if ok {
+		for _, a := range anchors.AnchorPeers {
+			org.AnchorPeers = append(org.AnchorPeers, fmt.Sprintf("%s:%d", a.Host, a.Port))
+		}
+	}
+
+	endpoints := &common.OrdererAddresses{}
+	if ok, err := configValue(g, "Endpoints", endpoints); err != nil {
+		return nil, err
+	} else if ok {
+		org.Endpoints = endpoints.Addresses
+	}
+	return org, nil
+}
+
+// configValue unmarshals the value of the key, false if the group does not have it
+func configValue(g *common.ConfigGroup, key string, m proto.Message) (bool, error) {
+	v := g.Values[key]
+	if v == nil {
+		return false, nil
+	}
+	if err := proto.Unmarshal(v.Value, m); err != nil {
+		return false, fmt.Errorf("failed to unmarshal config value %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func collectCapabilities(name string, g *common.ConfigGroup, caps map[string][]string) error {
+	c := &common.Capabilities{}
+	if ok, err := configValue(g, "Capabilities", c); err != nil || !ok {
+		return err
+	}
+	caps[name] = sortedKeys(c.Capabilities)
+	return nil
+}
+
+func collectVersions(path string, g *common.ConfigGroup, versions map[string]uint64) {
+	versions[path] = g.Version
+	for name, sub := range g.Groups {
+		collectVersions(path+"/"+name, sub, versions)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
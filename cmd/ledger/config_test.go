@@ -0,0 +1,88 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/peer"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+func configValueOf(m proto.Message) *common.ConfigValue {
+	data, _ := proto.Marshal(m)
+	return &common.ConfigValue{Value: data}
+}
+
+func mspValueOf(mspID string) *common.ConfigValue {
+	data, _ := proto.Marshal(&msp.FabricMSPConfig{Name: mspID})
+	return configValueOf(&msp.MSPConfig{Config: data})
+}
+
+func Test_DecodeConfig(t *testing.T) {
+	root := &common.ConfigGroup{
+		Version: 2,
+		Values: map[string]*common.ConfigValue{
+			"OrdererAddresses": configValueOf(&common.OrdererAddresses{Addresses: []string{"orderer0:7050"}}),
+			"Capabilities":     configValueOf(&common.Capabilities{Capabilities: map[string]*common.Capability{"V2_0": {}}}),
+		},
+		Groups: map[string]*common.ConfigGroup{
+			"Application": {
+				Version: 1,
+				Groups: map[string]*common.ConfigGroup{
+					"Org1": {Values: map[string]*common.ConfigValue{
+						"MSP":         mspValueOf("Org1MSP"),
+						"AnchorPeers": configValueOf(&peer.AnchorPeers{AnchorPeers: []*peer.AnchorPeer{{Host: "peer0.org1", Port: 7051}}}),
+					}},
+				},
+			},
+			"Orderer": {
+				Values: map[string]*common.ConfigValue{
+					"ConsensusType": configValueOf(&orderer.ConsensusType{Type: "etcdraft"}),
+				},
+				Groups: map[string]*common.ConfigGroup{
+					"OrdererOrg": {Values: map[string]*common.ConfigValue{
+						"MSP":       mspValueOf("OrdererMSP"),
+						"Endpoints": configValueOf(&common.OrdererAddresses{Addresses: []string{"orderer0:7050"}}),
+					}},
+				},
+			},
+		},
+	}
+	cfgEnv, _ := proto.Marshal(&common.ConfigEnvelope{Config: &common.Config{Sequence: 3, ChannelGroup: root}})
+	chdr, _ := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_CONFIG), ChannelId: "testchannel"})
+	payload, _ := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: chdr}, Data: cfgEnv})
+	env, _ := proto.Marshal(&common.Envelope{Payload: payload})
+	b := &block.Block{Block: &common.Block{Data: &common.BlockData{Data: [][]byte{env}}}, Num: 5}
+
+	cfg, err := decodeConfig(b)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := &channelConfig{
+		Channel:  "testchannel",
+		BlockNum: 5,
+		Sequence: 3,
+		Orgs: []orgConfig{
+			{Name: "Org1", MSPID: "Org1MSP", Role: "application", AnchorPeers: []string{"peer0.org1:7051"}},
+			{Name: "OrdererOrg", MSPID: "OrdererMSP", Role: "orderer", Endpoints: []string{"orderer0:7050"}},
+		},
+		Orderers:     []string{"orderer0:7050"},
+		Consensus:    "etcdraft",
+		Capabilities: map[string][]string{"Channel": {"V2_0"}},
+		Versions: map[string]uint64{
+			"Channel":                    2,
+			"Channel/Application":        1,
+			"Channel/Application/Org1":   0,
+			"Channel/Orderer":            0,
+			"Channel/Orderer/OrdererOrg": 0,
+		},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+}
@@ -0,0 +1,433 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/archive"
+	"github.com/key-inside/patrasche/block"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+	"github.com/key-inside/patrasche/schema"
+)
+
+func exportCommand(pflags *pflag.FlagSet) *cobra.Command {
+	v := viper.New()
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export Ledger Data",
+		Long:  "Exporting decoded blocks, transactions, chaincode events or writes in a block range to a file",
+		Run: func(cmd *cobra.Command, args []string) {
+			p := patrasche.Biter(cmd)
+			logger := p.Logger().With().Str("caller", "ldg export").Logger()
+
+			path := v.GetString("out")
+			if path == "" {
+				logger.Error().Msg("out is required")
+				return
+			}
+			exp, err := newExporter(path, v.GetString("format"), v.GetString("records"), v.GetUint64("from"), v.GetInt("checkpoint"))
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+			defer exp.Close()
+
+			client, closeSource, err := openSource(p, v)
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+			defer closeSource()
+
+			height, err := client.Height()
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+			from, to := v.GetUint64("from"), v.GetUint64("to")
+			if !v.IsSet("to") || to >= height {
+				to = height - 1
+			}
+			if last, ok := exp.LastBlock(); ok && last >= from { // resume
+				logger.Info().Uint64("last", last).Msg("resuming export")
+				from = last + 1
+			}
+			if height == 0 || from > to {
+				logger.Info().Msg("nothing to export")
+				return
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			prog := newExportProgress(&logger, from, to, v.GetDuration("progress"))
+			handler := block.HandlerFunc(func(b *block.Block) error {
+				if err := exp.Handle(b); err != nil {
+					return err
+				}
+				prog.add(b)
+				return nil
+			})
+			err = client.ScanBlocks(ctx, from, to, handler, ldgclient.WithScanWorkers(v.GetInt("workers")))
+			prog.report()
+			if err != nil {
+				logger.Error().Err(err).Msg("export stopped, run the same command to resume")
+				return
+			}
+			logger.Info().Uint64("from", from).Uint64("to", to).Str("out", path).Msg("export done")
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.Uint64("from", 0, "first block number")
+	flags.Uint64("to", 0, "last block number (default the last block)")
+	flags.String("format", "jsonl", "jsonl, csv or proto (archive file of raw blocks)")
+	flags.String("records", "tx", "block, tx, event or write, ignored by proto")
+	flags.String("out", "", "output file path")
+	flags.Int("workers", 4, "number of concurrent block queries")
+	flags.Int("checkpoint", 1000, "blocks between checkpoints, it is also saved when the export stops")
+	flags.Duration("progress", 10*time.Second, "progress reporting interval")
+
+	v.BindPFlags(flags)
+	v.BindPFlags(pflags)
+
+	return cmd
+}
+
+// exporter is a block handler writing the export file, it resumes after the last block
+type exporter interface {
+	block.Handler
+	LastBlock() (uint64, bool)
+	Close() error
+}
+
+// newExporter returns the exporter of the format, it refuses the file exported from another block than 'from'
+func newExporter(path, format, records string, from uint64, checkpointEvery int) (exporter, error) {
+	switch format {
+	case "proto":
+		w, err := archive.NewFileWriter(nil, path)
+		if err != nil {
+			return nil, err
+		}
+		if first, ok := w.FirstBlock(); ok && first != from {
+			w.Close()
+			return nil, fmt.Errorf("%s was exported from block %d, run with --from=%d to resume or remove it to restart", path, first, first)
+		}
+		return w, nil
+	case "jsonl", "csv":
+		return newFileExporter(path, format, records, from, checkpointEvery)
+	}
+	return nil, fmt.Errorf("unknown export format: %s", format)
+}
+
+// csv columns of the records, values are the fields of the JSON records
+var exportColumns = map[string][]string{
+	"block": {"block_num", "hash", "prev_hash", "data_hash", "tx_count", "timestamp"},
+	"tx":    {"tx_id", "block_num", "seq", "channel", "type", "timestamp", "mspid", "validation_code", "valid", "chaincode", "args", "status", "message", "event"},
+	"event": {"tx_id", "block_num", "seq", "timestamp", "chaincode", "name", "payload"},
+	"write": {"tx_id", "block_num", "seq", "namespace", "key", "value", "is_delete"},
+}
+
+// writeRecord is a write with its transaction
+type writeRecord struct {
+	TxID     string `json:"tx_id"`
+	BlockNum uint64 `json:"block_num"`
+	Seq      int    `json:"seq"`
+	schema.Write
+}
+
+func exportRecords(kind string, b *block.Block) ([]interface{}, error) {
+	if kind == "block" {
+		return []interface{}{schema.NewBlock(b)}, nil
+	}
+	records := []interface{}{}
+	for _, t := range b.Txs {
+		switch kind {
+		case "tx":
+			st, err := schema.NewTx(t)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, st)
+		case "event":
+			e, err := schema.NewEvent(t)
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				records = append(records, e)
+			}
+		case "write":
+			writes, err := schema.NewWrites(t)
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range writes {
+				records = append(records, writeRecord{TxID: t.ID(), BlockNum: t.BlockNum, Seq: t.Seq, Write: w})
+			}
+		}
+	}
+	return records, nil
+}
+
+// exportCheckpoint is saved to '<path>.ckpt' periodically and on close,
+// data after the offset (ex, written before an interruption) is truncated on resume
+type exportCheckpoint struct {
+	Format  string `json:"format"`
+	Records string `json:"records"`
+	From    uint64 `json:"from"` // the first block of the export
+	Block   uint64 `json:"block"`
+	Offset  int64  `json:"offset"`
+}
+
+// fileExporter writes JSON lines or CSV rows of the records
+type fileExporter struct {
+	format   string
+	records  string
+	from     uint64
+	ckptPath string
+	ckpt     *exportCheckpoint // of the last written block, saved every 'every' blocks
+	every    int
+	unsaved  int
+	saved    bool
+
+	file *os.File
+	w    *bufio.Writer
+	csv  *csv.Writer
+}
+
+// newFileExporter returns the exporter saving the checkpoint every 'every' blocks (and on close)
+func newFileExporter(path, format, records string, from uint64, every int) (*fileExporter, error) {
+	if _, ok := exportColumns[records]; !ok {
+		return nil, fmt.Errorf("unknown export records: %s", records)
+	}
+	if every < 1 {
+		every = 1
+	}
+	e := &fileExporter{format: format, records: records, from: from, ckptPath: path + ".ckpt", every: every}
+
+	var offset int64
+	if data, err := os.ReadFile(e.ckptPath); err == nil {
+		ckpt := &exportCheckpoint{}
+		if err := json.Unmarshal(data, ckpt); err != nil {
+			return nil, fmt.Errorf("failed to read export checkpoint: %w", err)
+		}
+		if ckpt.Format != format || ckpt.Records != records {
+			return nil, fmt.Errorf("%s was exported as %s %s, remove it and %s to restart", path, ckpt.Format, ckpt.Records, e.ckptPath)
+		}
+		if ckpt.From != from {
+			return nil, fmt.Errorf("%s was exported from block %d, run with --from=%d to resume or remove it and %s to restart", path, ckpt.From, ckpt.From, e.ckptPath)
+		}
+		e.ckpt = ckpt
+		e.saved = true
+		offset = ckpt.Offset
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+		return nil, fmt.Errorf("%s exists without %s, remove it or export to another file", path, e.ckptPath)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export file: %w", err)
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate export file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	e.file = file
+	e.w = bufio.NewWriter(file)
+	if format == "csv" {
+		e.csv = csv.NewWriter(e.w)
+	}
+	return e, nil
+}
+
+func (e *fileExporter) LastBlock() (uint64, bool) {
+	if e.ckpt == nil {
+		return 0, false
+	}
+	return e.ckpt.Block, true
+}
+
+func (e *fileExporter) Handle(b *block.Block) error {
+	if e.ckpt != nil && b.Num <= e.ckpt.Block {
+		return nil // already exported
+	}
+	records, err := exportRecords(e.records, b)
+	if err != nil {
+		return fmt.Errorf("failed to decode block %d: %w", b.Num, err)
+	}
+	if e.csv != nil && e.ckpt == nil { // the header is written with the first block, so a file without checkpoint is empty
+		if err := e.csv.Write(exportColumns[e.records]); err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+	}
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if e.csv != nil {
+			err = e.csv.Write(csvRow(data, exportColumns[e.records]))
+		} else {
+			_, err = e.w.Write(append(data, '\n'))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+	}
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+	}
+	if err := e.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	offset, err := e.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	e.ckpt = &exportCheckpoint{Format: e.format, Records: e.records, From: e.from, Block: b.Num, Offset: offset}
+	e.unsaved++
+	// the first checkpoint is saved at once, so the written file is never left without it
+	if e.unsaved >= e.every || !e.saved {
+		return e.sync()
+	}
+	return nil
+}
+
+// sync commits the written data to the disk and saves the checkpoint,
+// so the checkpoint never refers to data not on the disk
+func (e *fileExporter) sync() error {
+	if e.unsaved == 0 {
+		return nil
+	}
+	if err := e.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync export file: %w", err)
+	}
+	if err := e.saveCheckpoint(e.ckpt); err != nil {
+		return fmt.Errorf("failed to save export checkpoint: %w", err)
+	}
+	e.unsaved = 0
+	e.saved = true
+	return nil
+}
+
+// saveCheckpoint replaces the checkpoint file by renaming a temporary file, so it is never partially written
+func (e *fileExporter) saveCheckpoint(ckpt *exportCheckpoint) error {
+	data, err := json.Marshal(ckpt)
+	if err != nil {
+		return err
+	}
+	tmp := e.ckptPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, e.ckptPath)
+}
+
+// Close saves the checkpoint of the written blocks
+func (e *fileExporter) Close() error {
+	err := e.sync()
+	if e := e.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// csvRow returns the fields of the JSON record in the columns, strings are unquoted
+func csvRow(data []byte, columns []string) []string {
+	fields := map[string]json.RawMessage{}
+	json.Unmarshal(data, &fields)
+	row := make([]string, len(columns))
+	for i, c := range columns {
+		v, ok := fields[c]
+		if !ok || string(v) == "null" {
+			continue
+		}
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			row[i] = s
+		} else {
+			row[i] = string(v)
+		}
+	}
+	return row
+}
+
+// exportProgress logs the progress of the export at the interval
+type exportProgress struct {
+	logger   *zerolog.Logger
+	total    uint64
+	interval time.Duration
+
+	done     uint64
+	txs      int
+	last     uint64
+	started  time.Time
+	reported time.Time
+}
+
+func newExportProgress(logger *zerolog.Logger, from, to uint64, interval time.Duration) *exportProgress {
+	now := time.Now()
+	return &exportProgress{logger: logger, total: to - from + 1, interval: interval, started: now, reported: now}
+}
+
+func (p *exportProgress) add(b *block.Block) {
+	p.done++
+	p.txs += len(b.Txs)
+	p.last = b.Num
+	if p.interval > 0 && time.Since(p.reported) >= p.interval {
+		p.report()
+	}
+}
+
+func (p *exportProgress) report() {
+	p.reported = time.Now()
+	elapsed := p.reported.Sub(p.started)
+	rate := float64(p.done) / elapsed.Seconds()
+	event := p.logger.Info().
+		Uint64("block", p.last).
+		Uint64("done", p.done).
+		Uint64("total", p.total).
+		Int("txs", p.txs).
+		Str("percent", fmt.Sprintf("%.1f", float64(p.done)*100/float64(p.total))).
+		Float64("blocks_per_sec", rate)
+	if rate > 0 && p.done < p.total {
+		event = event.Dur("eta", time.Duration(float64(p.total-p.done)/rate*float64(time.Second)))
+	}
+	event.Msg("export progress")
+}
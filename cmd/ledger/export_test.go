@@ -0,0 +1,178 @@
+package ledger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+func Test_FileExporter(t *testing.T) {
+	blocks := []*block.Block{}
+	for i := uint64(0); i < 3; i++ {
+		blocks = append(blocks, blocktest.NewBlock(i).
+			AddEndorserTx("token", "transfer", "alice", "bob").
+			Write("token", "alice", []byte("90")).
+			Write("token", "bob", []byte("10")).
+			Block().Parse())
+	}
+	path := filepath.Join(t.TempDir(), "writes.csv")
+
+	e, err := newFileExporter(path, "csv", "write", 0, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, b := range blocks[:2] {
+		if err := e.Handle(b); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	e.Close()
+
+	// interrupted while writing the next block
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("partial,row")
+	f.Close()
+
+	if _, err := newFileExporter(path, "jsonl", "write", 0, 1); err == nil {
+		t.Error("expected checkpoint mismatch error")
+	}
+	if _, err := newFileExporter(path, "csv", "write", 1000, 1); err == nil {
+		t.Error("expected from mismatch error")
+	}
+	e, err = newFileExporter(path, "csv", "write", 0, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if last, ok := e.LastBlock(); !ok || last != 1 {
+		t.Fatalf("expected last block 1, got %d, %v", last, ok)
+	}
+	for _, b := range blocks { // already exported blocks are skipped
+		if err := e.Handle(b); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	e.Close()
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 7 || lines[0] != "tx_id,block_num,seq,namespace,key,value,is_delete" {
+		t.Fatalf("unexpected export: %q", lines)
+	}
+	if !strings.HasSuffix(lines[6], ",2,0,token,bob,MTA=,false") {
+		t.Errorf("unexpected row: %s", lines[6])
+	}
+}
+
+func Test_FileExporterExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writes.csv")
+	os.WriteFile(path, []byte("not exported\n"), 0644)
+	if _, err := newFileExporter(path, "csv", "write", 0, 1); err == nil {
+		t.Error("expected error for the file without checkpoint")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "not exported\n" {
+		t.Errorf("the file is modified: %q", data)
+	}
+
+	// closed without blocks, the file stays empty to export again
+	os.Remove(path)
+	e, err := newFileExporter(path, "csv", "write", 0, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e.Close()
+	e, err = newFileExporter(path, "csv", "write", 0, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := e.Handle(blocktest.NewBlock(0).AddEndorserTx("token", "mint").Write("token", "alice", []byte("1")).Block().Parse()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e.Close()
+	if _, err := os.Stat(path + ".ckpt.tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected no temporary checkpoint, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("unexpected export: %q", lines)
+	}
+}
+
+func Test_FileExporterCheckpointInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writes.jsonl")
+	newBlock := func(num uint64) *block.Block {
+		return blocktest.NewBlock(num).AddEndorserTx("token", "mint").Write("token", "alice", []byte("1")).Block().Parse()
+	}
+	readCheckpoint := func() exportCheckpoint {
+		ckpt := exportCheckpoint{}
+		data, _ := os.ReadFile(path + ".ckpt")
+		json.Unmarshal(data, &ckpt)
+		return ckpt
+	}
+
+	e, err := newFileExporter(path, "jsonl", "write", 0, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(0); i < 4; i++ {
+		if err := e.Handle(newBlock(i)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// saved on the first block, then every 2 blocks
+		if expected := []uint64{0, 0, 2, 2}[i]; readCheckpoint().Block != expected {
+			t.Errorf("block %d: expected checkpoint %d, got %d", i, expected, readCheckpoint().Block)
+		}
+	}
+
+	// interrupted without close, block 3 is exported again
+	e, err = newFileExporter(path, "jsonl", "write", 0, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if last, ok := e.LastBlock(); !ok || last != 2 {
+		t.Fatalf("expected last block 2, got %d, %v", last, ok)
+	}
+	if err := e.Handle(newBlock(3)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ckpt := readCheckpoint(); ckpt.Block != 3 {
+		t.Errorf("expected checkpoint 3 after close, got %d", ckpt.Block)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 4 {
+		t.Errorf("unexpected export: %q", lines)
+	}
+}
+
+func Test_ProtoExporterFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.arc")
+	e, err := newExporter(path, "proto", "", 5, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(5); i < 7; i++ {
+		if err := e.Handle(blocktest.NewBlock(i).AddEndorserTx("token", "mint").Block().Parse()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	e.Close()
+
+	if _, err := newExporter(path, "proto", "", 0, 1); err == nil {
+		t.Error("expected from mismatch error")
+	}
+	e, err = newExporter(path, "proto", "", 5, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer e.Close()
+	if last, ok := e.LastBlock(); !ok || last != 6 {
+		t.Errorf("expected last block 6, got %d, %v", last, ok)
+	}
+}
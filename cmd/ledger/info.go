@@ -0,0 +1,52 @@
+package ledger
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/key-inside/patrasche"
+)
+
+func infoCommand(pflags *pflag.FlagSet) *cobra.Command {
+	v := viper.New()
+	cmd := &cobra.Command{
+		Use:   "info",
+		Short: "Query Channel Info",
+		Long:  "Querying the height and the current and previous block hashes of the channel",
+		Run: func(cmd *cobra.Command, args []string) {
+			p := patrasche.Biter(cmd)
+			logger := p.Logger().With().Str("caller", "ldg info").Logger()
+
+			client, closeSource, err := openSource(p, v)
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+			defer closeSource()
+
+			info, err := client.Info()
+			if err != nil {
+				logger.Error().Err(err).Send()
+				return
+			}
+			printResult(p, &logger, "info", info)
+		},
+	}
+
+	v.BindPFlags(pflags)
+
+	return cmd
+}
+
+// printResult prints the result if --output is set, or logs it
+func printResult(p *patrasche.Patrasche, logger *zerolog.Logger, key string, v interface{}) {
+	if pr := p.Printer(); pr != nil {
+		if err := pr.Print(v); err != nil {
+			logger.Error().Err(err).Send()
+		}
+		return
+	}
+	logger.Info().Interface(key, v).Send()
+}
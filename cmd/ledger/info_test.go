@@ -0,0 +1,51 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/archive"
+	"github.com/key-inside/patrasche/cmd/inspect"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+func Test_InfoArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.arc")
+	w, err := archive.NewFileWriter(nil, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(0); i < 3; i++ {
+		if err := w.Handle(blocktest.NewBlock(i).AddEndorserTx("token", "mint").Block().Parse()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	w.Close()
+
+	// the ledger command is built before another command having the archive flag
+	root := &cobra.Command{Use: "test"}
+	root.AddCommand(Command(), inspect.Command())
+	out := bytes.NewBuffer(nil)
+	root.SetOut(out)
+	root.SetErr(bytes.NewBuffer(nil))
+	if _, err := patrasche.Bite(root); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	root.SetArgs([]string{"ldg", "info", "--archive", path, "-o", "json", "-q"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	info := ledgerInfo{}
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("unexpected output %q: %v", out.String(), err)
+	}
+	if info.Height != 3 {
+		t.Errorf("expected height 3, got %d", info.Height)
+	}
+}
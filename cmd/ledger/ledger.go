@@ -3,12 +3,16 @@ package ledger
 import (
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/archive"
 	"github.com/key-inside/patrasche/block"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+	"github.com/key-inside/patrasche/schema"
 	"github.com/key-inside/patrasche/tx"
 )
 
@@ -18,6 +22,7 @@ var cmd *cobra.Command
 
 func Command() *cobra.Command {
 	once.Do(func() {
+		v := viper.New()
 		cmd = &cobra.Command{
 			Use:   "ldg",
 			Short: "Query Ledger Data",
@@ -26,38 +31,85 @@ func Command() *cobra.Command {
 				p := patrasche.Biter(cmd)
 				logger := p.Logger().With().Str("caller", "ldg").Logger()
 
-				ch, err := p.NewChannel()
+				client, closeSource, err := openSource(p, v)
 				if err != nil {
 					logger.Error().Err(err).Send()
 					return
 				}
-				defer ch.Close()
+				defer closeSource()
 
-				client, err := ch.NewLedgerClient()
-				if err != nil {
-					logger.Error().Err(err).Send()
-					return
-				}
-
-				if viper.IsSet("block") { // query block
-					bn := viper.GetUint64("block")
+				if v.IsSet("start-time") || v.IsSet("end-time") { // query blocks in time range
+					from, to := uint64(0), ldgclient.CurrentHeight
+					if str := v.GetString("start-time"); str != "" {
+						t, err := time.Parse(time.RFC3339Nano, str)
+						if err != nil {
+							logger.Error().Err(err).Msg("invalid start-time")
+							return
+						}
+						if from, err = client.FindBlockByTime(t); err != nil {
+							logger.Error().Err(err).Send()
+							return
+						}
+					}
+					if str := v.GetString("end-time"); str != "" {
+						t, err := time.Parse(time.RFC3339Nano, str)
+						if err != nil {
+							logger.Error().Err(err).Msg("invalid end-time")
+							return
+						}
+						if to, err = client.FindLastBlockByTime(t); err != nil {
+							logger.Error().Err(err).Send()
+							return
+						}
+					}
+					logger.Info().Uint64("from", from).Uint64("to", to).Msg("resolved block range")
+					if to == ldgclient.CurrentHeight || from <= to {
+						var handler block.Handler = block.NewStdLogger(nil, &logger)
+						if pr := p.Printer(); pr != nil {
+							handler = block.HandlerFunc(func(b *block.Block) error {
+								return pr.Print(schema.NewBlock(b))
+							})
+						}
+						if err := client.ScanBlocks(cmd.Context(), from, to, handler); err != nil {
+							logger.Error().Err(err).Send()
+							return
+						}
+					}
+				} else if v.IsSet("block") { // query block
+					bn := v.GetUint64("block")
 					b, err := client.QueryBlock(bn)
 					if err != nil {
 						logger.Error().Err(err).Send()
 						return
 					}
+					if pr := p.Printer(); pr != nil {
+						if err := pr.Print(schema.NewBlock(b)); err != nil {
+							logger.Error().Err(err).Send()
+						}
+						return
+					}
 					blockLogger := block.NewStdLogger(nil, &logger)
 					if err := blockLogger.Handle(b); err != nil {
 						logger.Error().Err(err).Send()
 						return
 					}
-				} else if viper.IsSet("txid") { // query tx
-					txID := strings.ToLower(viper.GetString("txid"))
+				} else if v.IsSet("txid") { // query tx
+					txID := strings.ToLower(v.GetString("txid"))
 					t, err := client.QueryTransaction(txID)
 					if err != nil {
 						logger.Error().Err(err).Send()
 						return
 					}
+					if pr := p.Printer(); pr != nil {
+						st, err := schema.NewTx(t)
+						if err == nil {
+							err = pr.Print(st)
+						}
+						if err != nil {
+							logger.Error().Err(err).Send()
+						}
+						return
+					}
 					txLogger := tx.NewStdLogger(nil, &logger)
 					if err := txLogger.Handle(t); err != nil {
 						logger.Error().Err(err).Send()
@@ -70,9 +122,39 @@ func Command() *cobra.Command {
 		flags := cmd.Flags()
 		flags.Uint64P("block", "b", 0, "block number")
 		flags.StringP("txid", "t", "", "tx ID (hex)")
+		flags.String("start-time", "", "start time (RFC3339) of blocks")
+		flags.String("end-time", "", "end time (RFC3339) of blocks")
+
+		pflags := cmd.PersistentFlags()
+		pflags.String("archive", "", "archive file path, queries the archive instead of the channel")
+
+		v.BindPFlags(flags)
+		v.BindPFlags(pflags)
 
-		viper.BindPFlags(flags)
+		cmd.AddCommand(exportCommand(pflags), infoCommand(pflags), configCommand(pflags))
 	})
 
 	return cmd
 }
+
+// openSource opens the archive file if set, or the ledger of the channel
+func openSource(p *patrasche.Patrasche, v *viper.Viper) (source, func(), error) {
+	if path := v.GetString("archive"); path != "" { // offline
+		r, err := archive.OpenFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return archiveSource{r}, func() { r.Close() }, nil
+	}
+
+	ch, err := p.NewChannel()
+	if err != nil {
+		return nil, nil, err
+	}
+	ldgClient, err := ch.NewLedgerClient()
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+	return clientSource{ldgClient}, ch.Close, nil
+}
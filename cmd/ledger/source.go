@@ -0,0 +1,124 @@
+package ledger
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/key-inside/patrasche/archive"
+	"github.com/key-inside/patrasche/block"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// source is the ledger data queried by the command, a live channel or an archive file
+type source interface {
+	QueryBlock(blockNum uint64) (*block.Block, error)
+	QueryTransaction(txID string) (*tx.Tx, error)
+	FindBlockByTime(t time.Time) (uint64, error)
+	FindLastBlockByTime(t time.Time) (uint64, error)
+	ScanBlocks(ctx context.Context, from, to uint64, handler block.Handler, options ...ldgclient.ScanOption) error
+	// Height returns the number of blocks
+	Height() (uint64, error)
+	Info() (*ledgerInfo, error)
+	ConfigBlock() (*block.Block, error)
+}
+
+type ledgerInfo struct {
+	Height            uint64 `json:"height"`
+	CurrentBlockHash  string `json:"current_block_hash"` // hex
+	PreviousBlockHash string `json:"previous_block_hash"`
+	Endorser          string `json:"endorser,omitempty"` // the peer answered the query
+	Status            int32  `json:"status,omitempty"`
+}
+
+type clientSource struct {
+	client *ldgclient.Client
+}
+
+func (s clientSource) QueryBlock(blockNum uint64) (*block.Block, error) {
+	return s.client.QueryBlock(blockNum)
+}
+
+func (s clientSource) QueryTransaction(txID string) (*tx.Tx, error) {
+	return s.client.QueryTransaction(txID)
+}
+
+func (s clientSource) FindBlockByTime(t time.Time) (uint64, error) {
+	return s.client.FindBlockByTime(t)
+}
+
+func (s clientSource) FindLastBlockByTime(t time.Time) (uint64, error) {
+	return s.client.FindLastBlockByTime(t)
+}
+
+func (s clientSource) ScanBlocks(ctx context.Context, from, to uint64, handler block.Handler, options ...ldgclient.ScanOption) error {
+	return s.client.ScanBlocks(ctx, from, to, handler, options...)
+}
+
+func (s clientSource) Height() (uint64, error) {
+	info, err := s.client.QueryInfo()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query info: %w", err)
+	}
+	return info.BCI.Height, nil
+}
+
+func (s clientSource) Info() (*ledgerInfo, error) {
+	info, err := s.client.QueryInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query info: %w", err)
+	}
+	return &ledgerInfo{
+		Height:            info.BCI.Height,
+		CurrentBlockHash:  hex.EncodeToString(info.BCI.CurrentBlockHash),
+		PreviousBlockHash: hex.EncodeToString(info.BCI.PreviousBlockHash),
+		Endorser:          info.Endorser,
+		Status:            info.Status,
+	}, nil
+}
+
+func (s clientSource) ConfigBlock() (*block.Block, error) {
+	return s.client.QueryConfigBlock()
+}
+
+type archiveSource struct {
+	*archive.FileReader
+}
+
+// ScanBlocks handles blocks in order, ldgclient.CurrentHeight 'to' is the last archived block.
+// Scan options are ignored, blocks are read sequentially.
+func (s archiveSource) ScanBlocks(ctx context.Context, from, to uint64, handler block.Handler, options ...ldgclient.ScanOption) error {
+	return s.Replay(from, to, block.HandlerFunc(func(b *block.Block) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return handler.Handle(b)
+	}))
+}
+
+func (s archiveSource) Height() (uint64, error) {
+	return s.FileReader.Height(), nil
+}
+
+// Info returns the info of the last archived block
+func (s archiveSource) Info() (*ledgerInfo, error) {
+	info := &ledgerInfo{Height: s.FileReader.Height()}
+	if info.Height == 0 {
+		return info, nil
+	}
+	b, err := s.QueryBlock(info.Height - 1)
+	if err != nil {
+		return nil, err
+	}
+	info.CurrentBlockHash = hex.EncodeToString(b.Hash)
+	if b.Header != nil {
+		info.PreviousBlockHash = hex.EncodeToString(b.Header.PreviousHash)
+	}
+	return info, nil
+}
+
+func (s archiveSource) ConfigBlock() (*block.Block, error) {
+	return nil, fmt.Errorf("config block is not supported with archive")
+}
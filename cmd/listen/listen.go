@@ -0,0 +1,97 @@
+package listen
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/cmd/inspect"
+	"github.com/key-inside/patrasche/listener"
+	"github.com/key-inside/patrasche/pipeline"
+	"github.com/key-inside/patrasche/tx"
+)
+
+var once sync.Once
+
+var cmd *cobra.Command
+
+func Command() *cobra.Command {
+	once.Do(func() {
+		v := viper.New()
+		// the inspect tx handler can be used as a sink of this command
+		registry := pipeline.NewRegistry()
+		registry.RegisterSink("inspect", func(params pipeline.Params, env *pipeline.Env) (tx.Handler, error) {
+			return inspect.NewTxHandler(*env.Logger), nil
+		})
+
+		cmd = &cobra.Command{
+			Use:   "listen",
+			Short: "Listen blocks with the pipeline",
+			Long:  "Listening blocks and handling them with the handler pipeline described in the config",
+			Run: func(cmd *cobra.Command, args []string) {
+				p := patrasche.Biter(cmd)
+				logger := p.Logger().With().Str("caller", "listen").Logger()
+
+				// the listener handles blocks synchronously, so cancel retry backoffs on signals to shut down promptly
+				ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+
+				pl, err := p.NewPipelineWithRegistry(ctx, registry)
+				if err != nil {
+					logger.Error().Err(err).Msg("failed to build pipeline")
+					return
+				}
+				defer pl.Close()
+
+				opts := []listener.Option{
+					listener.WithShutdown(func(sig os.Signal) {
+						logger.Info().Str("signal", sig.String()).Msg("shutting down...")
+					}),
+					listener.WithStop(func(reason listener.StopReason) {
+						logger.Info().Stringer("reason", reason).Msg("listener stopped")
+					}),
+				}
+				// --start, or the next block of the checkpoint
+				var start *uint64
+				if v.IsSet("start") {
+					bn := v.GetUint64("start")
+					start = &bn
+				}
+				bn, ok, err := pl.StartBlock(start)
+				if err != nil {
+					logger.Error().Err(err).Msg("failed to resolve the start block")
+					return
+				}
+				if ok {
+					if start != nil && bn < *start {
+						logger.Warn().Uint64("start", *start).Uint64("resumed", bn).Msg("resume from an earlier block not to leave a gap")
+					}
+					logger.Info().Uint64("start", bn).Msg("start block")
+					opts = append(opts, listener.WithStartBlock(bn))
+				}
+				if v.IsSet("end") {
+					opts = append(opts, listener.WithEndBlock(v.GetUint64("end")))
+				}
+
+				if err := p.ListenBlock(pl, opts...); err != nil {
+					logger.Error().Err(err).Msg("")
+					return
+				}
+			},
+		}
+
+		flags := cmd.Flags()
+		flags.Uint64("start", 0, "start block number, if not set, from the next block of the checkpoint or the newest")
+		flags.Uint64("end", 0, "end block number")
+
+		v.BindPFlags(flags)
+	})
+
+	return cmd
+}
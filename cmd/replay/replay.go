@@ -0,0 +1,111 @@
+package replay
+
+import (
+	"context"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/archive"
+	"github.com/key-inside/patrasche/aws"
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/deadletter"
+	"github.com/key-inside/patrasche/tx"
+)
+
+var once sync.Once
+
+var cmd *cobra.Command
+
+func Command() *cobra.Command {
+	once.Do(func() {
+		v := viper.New()
+		cmd = &cobra.Command{
+			Use:   "replay",
+			Short: "Replay dead-letters or archived blocks",
+			Long:  "Reprocessing skipped blocks and transactions recorded in a dead-letter sink, or blocks in an archive",
+			Run: func(cmd *cobra.Command, args []string) {
+				p := patrasche.Biter(cmd)
+				logger := p.Logger().With().Str("caller", "replay").Logger()
+
+				// reprocess with the pipeline described in the config, without moving its checkpoint back
+				ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+				pl, err := p.NewPipeline(ctx)
+				if err != nil {
+					logger.Error().Err(err).Msg("failed to build pipeline")
+					return
+				}
+				defer pl.Close()
+				defer func() {
+					if err := pl.Flush(); err != nil {
+						logger.Error().Err(err).Msg("failed to flush pipeline")
+					}
+				}()
+
+				blockHandler, txHandler := pl.ReplayHandler(), pl.TxHandler()
+				if v.GetBool("log") {
+					blockHandler = block.NewStdLogger(blockHandler, &logger)
+					txHandler = tx.NewStdLogger(txHandler, &logger)
+				}
+
+				if location := v.GetString("archive"); location != "" {
+					store, err := archive.OpenStore(location, func() awssdk.Config { return awsConfig(v) })
+					if err != nil {
+						logger.Error().Err(err).Send()
+						return
+					}
+					to := archive.All
+					if v.IsSet("end") {
+						to = v.GetUint64("end")
+					}
+					if err := archive.NewReader(store).Replay(v.GetUint64("start"), to, blockHandler); err != nil {
+						logger.Error().Err(err).Send()
+					}
+					return
+				}
+
+				var src deadletter.Source
+				if path := v.GetString("file"); path != "" {
+					src = deadletter.NewFileSource(path)
+				} else if table := v.GetString("table"); table != "" {
+					src = deadletter.NewDynamoDBSink(awsConfig(v), table)
+				} else {
+					logger.Error().Msg("file, table or archive is required")
+					return
+				}
+
+				if err := block.ReplayDeadLetters(src, blockHandler, txHandler); err != nil {
+					logger.Error().Err(err).Send()
+					return
+				}
+			},
+		}
+
+		flags := cmd.Flags()
+		flags.String("file", "", "dead-letter file path")
+		flags.String("table", "", "dead-letter DynamoDB table name")
+		flags.String("archive", "", "block archive location, directory path or s3://bucket/prefix")
+		flags.Uint64("start", 0, "start block number of the archive")
+		flags.Uint64("end", 0, "end block number of the archive, if not set, to the last block")
+		flags.String("endpoint", "", "AWS endpoint URL (ex, DynamoDB Local)")
+		flags.String("region", "", "AWS region for the endpoint")
+		flags.Bool("log", false, "log replayed blocks and transactions")
+
+		v.BindPFlags(flags)
+	})
+
+	return cmd
+}
+
+func awsConfig(v *viper.Viper) awssdk.Config {
+	if endpoint := v.GetString("endpoint"); endpoint != "" {
+		return aws.DefaultConfig(aws.WithEndpoint(v.GetString("region"), endpoint))
+	}
+	return aws.DefaultConfig()
+}
@@ -0,0 +1,128 @@
+package stats
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/archive"
+	"github.com/key-inside/patrasche/blockfile"
+	"github.com/key-inside/patrasche/listener"
+	"github.com/key-inside/patrasche/output"
+	chainstats "github.com/key-inside/patrasche/stats"
+)
+
+var once sync.Once
+
+var cmd *cobra.Command
+
+func Command() *cobra.Command {
+	once.Do(func() {
+		v := viper.New()
+		cmd = &cobra.Command{
+			Use:   "stats",
+			Short: "Chain statistics",
+			Long:  "Aggregating tx counts by type, chaincode, function, creator MSP, validation code and event, block sizes and tx per block over a block range or a live stream",
+			Run: func(cmd *cobra.Command, args []string) {
+				p := patrasche.Biter(cmd)
+				logger := p.Logger().With().Str("caller", "stats").Logger()
+
+				collector, err := chainstats.NewCollector(nil, chainstats.WithTimeBucket(v.GetDuration("time-bucket")))
+				if err != nil {
+					logger.Error().Err(err).Send()
+					return
+				}
+
+				opts := []listener.Option{
+					listener.WithShutdown(func(sig os.Signal) {
+						logger.Info().Str("signal", sig.String()).Msg("shutting down...")
+					}),
+					listener.WithStop(func(reason listener.StopReason) {
+						logger.Info().Stringer("reason", reason).Msg("listener stopped")
+					}),
+				}
+				if v.IsSet("start") {
+					opts = append(opts, listener.WithStartBlock(v.GetUint64("start")))
+				}
+				if v.IsSet("end") {
+					opts = append(opts, listener.WithEndBlock(v.GetUint64("end")))
+				}
+				if str := v.GetString("stop-time"); str != "" {
+					t, err := time.Parse(time.RFC3339Nano, str)
+					if err != nil {
+						logger.Error().Err(err).Msg("invalid stop-time")
+						return
+					}
+					opts = append(opts, listener.WithBlockTimeLimit(t))
+				}
+				if d := v.GetDuration("duration"); d > 0 {
+					opts = append(opts, listener.WithDeadline(time.Now().Add(d)))
+				}
+				if v.GetBool("until-height") {
+					opts = append(opts, listener.WithStopAtHeight())
+				}
+
+				// block source, the channel if nil
+				var source listener.BlockSource
+				if path := v.GetString("archive"); path != "" { // offline
+					r, err := archive.OpenFile(path)
+					if err != nil {
+						logger.Error().Err(err).Send()
+						return
+					}
+					defer r.Close()
+					source = listener.NewRangeSource(r)
+				} else if dir := v.GetString("blockfiles"); dir != "" { // offline
+					r, err := blockfile.Open(dir)
+					if err != nil {
+						logger.Error().Err(err).Send()
+						return
+					}
+					source = listener.NewRangeSource(r)
+				}
+
+				if source != nil {
+					l, err := listener.New(source, collector, opts...)
+					if err == nil {
+						err = l.Listen()
+					}
+					if err != nil {
+						logger.Error().Err(err).Send()
+					}
+				} else if err := p.ListenBlock(collector, opts...); err != nil {
+					logger.Error().Err(err).Send()
+				}
+
+				// the partial report is printed even if listening failed
+				report := collector.Report()
+				if pr := p.Printer(); pr != nil && pr.Format() != output.Table {
+					if err := pr.Print(report); err != nil {
+						logger.Error().Err(err).Send()
+					}
+					return
+				}
+				if err := report.WriteTable(cmd.OutOrStdout()); err != nil {
+					logger.Error().Err(err).Send()
+				}
+			},
+		}
+
+		flags := cmd.Flags()
+		flags.Uint64("start", 0, "start block number, if not set, seek from newest")
+		flags.Uint64("end", 0, "end block number")
+		flags.String("stop-time", "", "stop time (RFC3339), stops when a block timestamp passes it")
+		flags.Duration("duration", 0, "stops after the duration")
+		flags.Bool("until-height", false, "stops when caught up with the chain height at start")
+		flags.String("archive", "", "archive file path, aggregates the archive instead of the channel")
+		flags.String("blockfiles", "", "peer block files directory, aggregates the block files instead of the channel")
+		flags.Duration("time-bucket", time.Hour, "interval of the time histogram")
+
+		v.BindPFlags(flags)
+	})
+
+	return cmd
+}
@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/key-inside/patrasche"
+	"github.com/key-inside/patrasche/archive"
+	chainstats "github.com/key-inside/patrasche/stats"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+func Test_UntilHeightArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.arc")
+	w, err := archive.NewFileWriter(nil, path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		if err := w.Handle(blocktest.NewBlock(i).AddEndorserTx("token", "mint").Block().Parse()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	w.Close()
+
+	root := &cobra.Command{Use: "test"}
+	root.AddCommand(Command())
+	out := bytes.NewBuffer(nil)
+	root.SetOut(out)
+	root.SetErr(bytes.NewBuffer(nil))
+	if _, err := patrasche.Bite(root); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	root.SetArgs([]string{"stats", "--archive", path, "--start", "2", "--until-height", "-o", "json", "-q"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report := chainstats.Report{}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("unexpected output %q: %v", out.String(), err)
+	}
+	if report.Blocks != 3 || report.FirstBlock != 2 || report.LastBlock != 4 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
@@ -1,5 +1,7 @@
 package patrasche
 
+import "github.com/key-inside/patrasche/pipeline"
+
 type Config struct {
 	Fabric struct {
 		EnvPrefix string   `mapstructure:""`
@@ -14,4 +16,6 @@ type Config struct {
 	Logging struct {
 		Level string `mapstructure:""`
 	}
+
+	Pipeline pipeline.Config `mapstructure:""`
 }
@@ -0,0 +1,123 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is a skipped block or transaction.
+// A tx record has the raw envelope and a block record has the raw block.
+type Record struct {
+	BlockNum       uint64    `json:"block_num" dynamodbav:"block_num"`
+	TxID           string    `json:"tx_id,omitempty" dynamodbav:"tx_id,omitempty"`
+	Seq            int       `json:"seq" dynamodbav:"seq"`
+	ValidationCode int32     `json:"validation_code" dynamodbav:"validation_code"`
+	Error          string    `json:"error" dynamodbav:"error"`
+	Envelope       []byte    `json:"envelope,omitempty" dynamodbav:"envelope,omitempty"`
+	Block          []byte    `json:"block,omitempty" dynamodbav:"block,omitempty"`
+	Time           time.Time `json:"time" dynamodbav:"time"`
+}
+
+// ID returns the unique ID of the record
+func (r Record) ID() string {
+	if r.TxID != "" {
+		return fmt.Sprintf("%d:%s", r.BlockNum, r.TxID)
+	}
+	return fmt.Sprintf("%d", r.BlockNum)
+}
+
+// IsBlock reports whether the record is for a block
+func (r Record) IsBlock() bool {
+	return r.TxID == "" && len(r.Block) > 0
+}
+
+// Sink stores dead-letter records
+type Sink interface {
+	Put(Record) error
+}
+
+// Source iterates dead-letter records for replay
+type Source interface {
+	Range(fn func(Record) error) error
+}
+
+// FileSink appends records to a JSON lines file
+type FileSink struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, file: f}, nil
+}
+
+func (s *FileSink) Put(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead-letter record: %w", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// FileSource reads records from a JSON lines file written by FileSink
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Range reads the records written before it is called,
+// so records appended while replaying (ex, failed again to the same file) are not read again
+func (s *FileSource) Range(fn func(Record) error) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(f, info.Size()))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // raw blocks can be large
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return fmt.Errorf("invalid dead-letter record at line %d: %w", line, err)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
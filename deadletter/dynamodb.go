@@ -0,0 +1,67 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+type dynamoDBItem struct {
+	ID string `dynamodbav:"id"`
+	Record
+}
+
+// DynamoDBSink puts records into a DynamoDB table whose partition key is 'id' (string)
+// It also works as a Source by scanning the table.
+type DynamoDBSink struct {
+	client *dynamodb.Client
+	table  string
+}
+
+func NewDynamoDBSink(cfg aws.Config, table string) *DynamoDBSink {
+	return &DynamoDBSink{
+		client: dynamodb.NewFromConfig(cfg),
+		table:  table,
+	}
+}
+
+func (s *DynamoDBSink) Put(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	item, err := attributevalue.MarshalMap(dynamoDBItem{ID: r.ID(), Record: r})
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead-letter record: %w", err)
+	}
+	_, err = s.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	})
+	return err
+}
+
+func (s *DynamoDBSink) Range(fn func(Record) error) error {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.table),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return fmt.Errorf("failed to scan dead-letter table: %w", err)
+		}
+		for _, item := range page.Items {
+			var di dynamoDBItem
+			if err := attributevalue.UnmarshalMap(item, &di); err != nil {
+				return fmt.Errorf("failed to unmarshal dead-letter record: %w", err)
+			}
+			if err := fn(di.Record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
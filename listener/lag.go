@@ -0,0 +1,160 @@
+package listener
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+// default interval of querying the chain height when only WithCaughtUp is set
+const defaultLagInterval = 10 * time.Second
+
+// Lag is the distance between the listener and the tip of the chain
+type Lag struct {
+	BlockNum uint64        // last handled block number
+	Height   uint64        // chain height
+	Blocks   uint64        // number of blocks behind the tip
+	Time     time.Duration // estimated time behind, now - timestamp of the last handled block
+	CaughtUp bool
+}
+
+type lagTracker struct {
+	interval  time.Duration
+	report    func(Lag)
+	caughtUp  func(Lag)
+	logger    *zerolog.Logger
+	query     func() (uint64, error)
+	next      *uint64 // next block number if known
+	mutex     sync.Mutex
+	height    uint64
+	handled   bool
+	blockNum  uint64
+	blockTime time.Time
+	once      sync.Once
+}
+
+func (l *Listener) newLagTracker() *lagTracker {
+	if l.lagInterval <= 0 && l.caughtUp == nil {
+		return nil
+	}
+	if _, ok := l.source.(HeightSource); !ok {
+		return nil
+	}
+	interval := l.lagInterval
+	if interval <= 0 {
+		interval = defaultLagInterval
+	}
+	return &lagTracker{
+		interval: interval,
+		report:   l.lagReport,
+		caughtUp: l.caughtUp,
+		logger:   l.logger,
+		query:    l.queryHeight,
+		next:     l.startBlock,
+	}
+}
+
+// run polls the chain height until done is closed
+func (t *lagTracker) run(done <-chan struct{}) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		t.poll()
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (t *lagTracker) poll() {
+	height, err := t.query()
+	if err != nil {
+		if t.logger != nil {
+			t.logger.Warn().Err(err).Msg("failed to query chain height")
+		}
+		return
+	}
+
+	t.mutex.Lock()
+	t.height = height
+	lag, ok := t.lag()
+	t.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	if t.logger != nil {
+		t.logger.Info().
+			Uint64("block_number", lag.BlockNum).
+			Uint64("height", lag.Height).
+			Uint64("blocks", lag.Blocks).
+			Dur("time", lag.Time).
+			Bool("caught_up", lag.CaughtUp).
+			Msg("lag")
+	}
+	if t.report != nil {
+		t.report(lag)
+	}
+	if lag.CaughtUp {
+		t.fireCaughtUp(lag)
+	}
+}
+
+// handle is called after a block is handled
+func (t *lagTracker) handle(b *block.Block) {
+	t.mutex.Lock()
+	t.handled = true
+	t.blockNum = b.Num
+	if ts := b.Timestamp(); ts != nil {
+		t.blockTime = ts.UTC()
+	}
+	lag, ok := t.lag()
+	t.mutex.Unlock()
+	if ok && lag.CaughtUp {
+		t.fireCaughtUp(lag)
+	}
+}
+
+// lag MUST be called with the lock
+func (t *lagTracker) lag() (Lag, bool) {
+	if t.height == 0 {
+		return Lag{}, false
+	}
+	lag := Lag{Height: t.height}
+	if t.handled {
+		lag.BlockNum = t.blockNum
+		if t.blockNum+1 < t.height {
+			lag.Blocks = t.height - 1 - t.blockNum
+		}
+		if !t.blockTime.IsZero() {
+			lag.Time = time.Since(t.blockTime)
+		}
+	} else if t.next != nil {
+		if *t.next < t.height {
+			lag.Blocks = t.height - *t.next
+		}
+	} else {
+		return Lag{}, false // seeking from newest, unknown until the first block
+	}
+	lag.CaughtUp = t.handled && lag.Blocks == 0
+	return lag, true
+}
+
+func (t *lagTracker) fireCaughtUp(lag Lag) {
+	t.once.Do(func() {
+		if t.logger != nil {
+			t.logger.Info().
+				Uint64("block_number", lag.BlockNum).
+				Uint64("height", lag.Height).
+				Msg("caught up")
+		}
+		if t.caughtUp != nil {
+			t.caughtUp(lag)
+		}
+	})
+}
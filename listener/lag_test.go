@@ -0,0 +1,45 @@
+package listener
+
+import (
+	"testing"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+func Test_LagTracker(t *testing.T) {
+	height := uint64(100)
+	start := uint64(10)
+	caughtUp := 0
+	reports := []Lag{}
+	tracker := &lagTracker{
+		query:    func() (uint64, error) { return height, nil },
+		next:     &start,
+		report:   func(lag Lag) { reports = append(reports, lag) },
+		caughtUp: func(Lag) { caughtUp++ },
+	}
+
+	tracker.poll()
+	if len(reports) != 1 || reports[0].Blocks != 90 || reports[0].CaughtUp {
+		t.Fatalf("unexpected lag before the first block: %+v", reports)
+	}
+
+	tracker.handle(&block.Block{Num: 49})
+	tracker.poll()
+	if lag := reports[1]; lag.BlockNum != 49 || lag.Blocks != 50 || lag.CaughtUp {
+		t.Fatalf("unexpected lag: %+v", lag)
+	}
+
+	tracker.handle(&block.Block{Num: 99})
+	if caughtUp != 1 {
+		t.Fatalf("expected caught up event, got %d", caughtUp)
+	}
+	height = 102
+	tracker.poll()
+	tracker.handle(&block.Block{Num: 101})
+	if caughtUp != 1 {
+		t.Errorf("caught up event must be emitted once, got %d", caughtUp)
+	}
+	if lag := reports[2]; lag.Blocks != 2 || lag.CaughtUp {
+		t.Errorf("unexpected lag: %+v", lag)
+	}
+}
@@ -7,31 +7,53 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
 
 	"github.com/key-inside/patrasche/block"
-	"github.com/key-inside/patrasche/channel"
-	evtclient "github.com/key-inside/patrasche/client/event"
 )
 
 type Listener struct {
-	ch         *channel.Channel
+	source     BlockSource
 	handler    block.Handler
 	startBlock *uint64
 	endBlock   *uint64
 	shutdown   func(os.Signal)
+	stop       func(StopReason)
+
+	// stop conditions
+	deadline      *time.Time
+	maxBlocks     uint64
+	maxTxs        uint64
+	blockTime     *time.Time
+	stopAtHeight  bool
+	stopCondition func(*block.Block) bool
+
+	// catch-up
+	lagInterval time.Duration
+	lagReport   func(Lag)
+	caughtUp    func(Lag)
+	logger      *zerolog.Logger
+
+	stopReason StopReason
+
+	// notified of SIGINT and SIGTERM if nil, tests send signals to it
+	signals chan os.Signal
 }
 
 type Option func(*Listener) error
 
-func New(ch *channel.Channel, handler block.Handler, options ...Option) (*Listener, error) {
-	if ch == nil {
-		return nil, errors.New("channel is nil")
+// New returns a listener handling the blocks from the source, ex) NewDeliverSource(ch)
+func New(source BlockSource, handler block.Handler, options ...Option) (*Listener, error) {
+	if source == nil {
+		return nil, errors.New("block source is nil")
 	}
 	if handler == nil {
 		return nil, errors.New("block handler is nil")
 	}
 
-	l := &Listener{ch: ch, handler: handler}
+	l := &Listener{source: source, handler: handler}
 
 	for _, option := range options {
 		if err := option(l); err != nil {
@@ -42,76 +64,162 @@ func New(ch *channel.Channel, handler block.Handler, options ...Option) (*Listen
 	return l, nil
 }
 
+// StopReason returns the reason why Listen returned
+func (l *Listener) StopReason() StopReason {
+	return l.stopReason
+}
+
 func (l *Listener) Listen() error {
-	opts := []evtclient.Option{}
-	if l.startBlock != nil {
-		opts = append(opts, evtclient.WithBlockNum(*l.startBlock))
-	}
-	client, err := l.ch.NewBlockEventClient(opts...)
-	if err != nil {
-		return fmt.Errorf("failed to create event client: %w", err)
+	l.stopReason = StopReasonNone
+
+	var heightBlock *uint64 // last block number at start
+	if l.stopAtHeight {
+		height, err := l.queryHeight()
+		if err != nil {
+			return err
+		}
+		if height == 0 || (l.startBlock != nil && *l.startBlock >= height) {
+			l.stopReason = StopReasonCaughtUp
+			if l.stop != nil {
+				l.stop(l.stopReason)
+			}
+			return nil
+		}
+		last := height - 1
+		heightBlock = &last
 	}
-	registration, notifier, err := client.RegisterBlockEvent()
+
+	blocks, err := l.source.Blocks(l.startBlock)
 	if err != nil {
-		return fmt.Errorf("failed to register block event: %w", err)
+		return err
 	}
 
 	quitCh := make(chan error, 1)
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	sigCh := l.signals
+	if sigCh == nil {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+	}
+
+	var deadlineCh <-chan time.Time
+	if l.deadline != nil {
+		timer := time.NewTimer(time.Until(*l.deadline))
+		defer timer.Stop()
+		deadlineCh = timer.C
+	}
+
+	tracker := l.newLagTracker()
+	if tracker != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go tracker.run(done)
+	}
 
 	stopping := false
 
 	var m sync.Mutex
-	quit := func(retErr error) {
+	quit := func(reason StopReason, retErr error) {
 		m.Lock()
 		defer m.Unlock()
 		if stopping {
 			return
 		}
 		stopping = true
-		// asynchronous unregister
+		l.stopReason = reason
+		// asynchronous close, blocks are consumed until the source is closed
 		go func() {
-			client.Unregister(registration)
+			l.source.Close()
 			quitCh <- retErr
 		}()
 	}
 
+	var blockCount, txCount uint64
+
 	for {
 		select {
 		case sig := <-sigCh:
-			quit(nil)
+			quit(StopReasonSignal, nil)
 			if l.shutdown != nil {
 				l.shutdown(sig)
 			}
-		case evt := <-notifier: // block event
-			if evt != nil {
+		case <-deadlineCh:
+			quit(StopReasonDeadline, nil)
+		case cb, ok := <-blocks:
+			if ok {
 				if !stopping {
-					b, err := block.New(evt.Block)
+					b, err := block.New(cb)
 					if err != nil {
-						quit(fmt.Errorf("failed to parse block data: %w", err))
+						quit(StopReasonError, fmt.Errorf("failed to parse block data: %w", err))
 						break
 					}
+					if l.blockTime != nil {
+						if ts := b.Timestamp(); ts != nil && ts.UTC().After(*l.blockTime) {
+							quit(StopReasonBlockTime, nil) // does not handle the block
+							break
+						}
+					}
 					if err := l.handler.Handle(b); err != nil {
-						quit(err)
+						quit(StopReasonError, err)
 						break
 					}
-					if l.endBlock != nil && b.Num >= *l.endBlock {
-						quit(nil)
+					if tracker != nil {
+						tracker.handle(b)
+					}
+					blockCount++
+					txCount += uint64(len(b.Txs))
+					if reason := l.checkStop(b, blockCount, txCount, heightBlock); reason != StopReasonNone {
+						quit(reason, nil)
 					}
 				}
-				// else MUST consume events in buffer for closing the channel.
-				// because, when unregister event channel, fabric-sdk-go write nil to channel.
-				// so, if the channel buffer is full, it will be pended forever.
 			} else {
-				quit(nil)
+				blocks = nil // stops receiving from the closed channel
+				if err := l.source.Err(); err != nil {
+					quit(StopReasonError, err)
+				} else {
+					quit(StopReasonClosed, nil)
+				}
 			}
 		case e := <-quitCh:
+			// flushes buffered blocks, ex) block.Batcher or a chain having it
+			if f, ok := l.handler.(block.Flusher); ok {
+				if err := f.Flush(); err != nil && e == nil {
+					e = fmt.Errorf("failed to flush handler: %w", err)
+				}
+			}
+			if l.stop != nil {
+				l.stop(l.stopReason)
+			}
 			return e
 		}
 	}
 }
 
+// checkStop checks stop conditions after handling a block
+func (l *Listener) checkStop(b *block.Block, blockCount, txCount uint64, heightBlock *uint64) StopReason {
+	switch {
+	case l.endBlock != nil && b.Num >= *l.endBlock:
+		return StopReasonEndBlock
+	case heightBlock != nil && b.Num >= *heightBlock:
+		return StopReasonCaughtUp
+	case l.maxBlocks > 0 && blockCount >= l.maxBlocks:
+		return StopReasonBlockCount
+	case l.maxTxs > 0 && txCount >= l.maxTxs:
+		return StopReasonTxCount
+	case l.stopCondition != nil && l.stopCondition(b):
+		return StopReasonCondition
+	}
+	return StopReasonNone
+}
+
+func (l *Listener) queryHeight() (uint64, error) {
+	hs, ok := l.source.(HeightSource)
+	if !ok {
+		return 0, errors.New("block source has no height")
+	}
+	return hs.Height()
+}
+
 func WithStartBlock(blockNum uint64) Option {
 	return func(l *Listener) error {
 		l.startBlock = &blockNum
@@ -132,3 +240,86 @@ func WithShutdown(shutdown func(os.Signal)) Option {
 		return nil
 	}
 }
+
+// WithStop sets the function called with the stop reason when listening is finished
+func WithStop(stop func(StopReason)) Option {
+	return func(l *Listener) error {
+		l.stop = stop
+		return nil
+	}
+}
+
+// WithDeadline stops the listener at the wall-clock time
+func WithDeadline(t time.Time) Option {
+	return func(l *Listener) error {
+		l.deadline = &t
+		return nil
+	}
+}
+
+// WithMaxBlocks stops the listener after handling n blocks
+func WithMaxBlocks(n uint64) Option {
+	return func(l *Listener) error {
+		l.maxBlocks = n
+		return nil
+	}
+}
+
+// WithMaxTxs stops the listener after handling blocks containing n transactions in total
+func WithMaxTxs(n uint64) Option {
+	return func(l *Listener) error {
+		l.maxTxs = n
+		return nil
+	}
+}
+
+// WithBlockTimeLimit stops the listener when a block timestamp passes t.
+// The block that passes t is not handled.
+func WithBlockTimeLimit(t time.Time) Option {
+	return func(l *Listener) error {
+		l.blockTime = &t
+		return nil
+	}
+}
+
+// WithStopAtHeight stops the listener after handling the last block at the time of start.
+// The chain height is queried from the block source (HeightSource) when Listen is called.
+func WithStopAtHeight() Option {
+	return func(l *Listener) error {
+		l.stopAtHeight = true
+		return nil
+	}
+}
+
+// WithStopCondition stops the listener when the condition returns true after handling a block
+func WithStopCondition(condition func(*block.Block) bool) Option {
+	return func(l *Listener) error {
+		l.stopCondition = condition
+		return nil
+	}
+}
+
+// WithLagReport queries the chain height every interval and reports the lag of the listener
+func WithLagReport(interval time.Duration, report func(Lag)) Option {
+	return func(l *Listener) error {
+		l.lagInterval = interval
+		l.lagReport = report
+		return nil
+	}
+}
+
+// WithCaughtUp sets the function called once when the listener reaches the tip of the chain
+func WithCaughtUp(caughtUp func(Lag)) Option {
+	return func(l *Listener) error {
+		l.caughtUp = caughtUp
+		return nil
+	}
+}
+
+// WithLogger sets the logger for lag reports
+func WithLogger(logger *zerolog.Logger) Option {
+	return func(l *Listener) error {
+		l.logger = logger
+		return nil
+	}
+}
@@ -0,0 +1,187 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+
+	"github.com/key-inside/patrasche/channel"
+	evtclient "github.com/key-inside/patrasche/client/event"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+)
+
+// BlockSource streams raw blocks to the listener, ex) the deliver service of peers, archives and block files
+type BlockSource interface {
+	// Blocks starts streaming from the start block number, nil start is the newest block of live sources
+	// or the first block of stored sources. The channel is closed when the stream ends.
+	Blocks(start *uint64) (<-chan *common.Block, error)
+	// Err returns the error which ended the stream, nil if the stream ended normally or was closed
+	Err() error
+	// Close stops streaming, the channel is closed after it
+	Close() error
+}
+
+// HeightSource is a block source knowing the chain height, it is required by WithStopAtHeight and lag reports
+type HeightSource interface {
+	Height() (uint64, error)
+}
+
+// DeliverSource streams blocks from the deliver service of the channel peers
+type DeliverSource struct {
+	ch *channel.Channel
+
+	mutex        sync.Mutex
+	client       *evtclient.Client
+	registration fab.Registration
+	done         chan struct{}
+	once         sync.Once
+	ldgClient    *ldgclient.Client
+}
+
+func NewDeliverSource(ch *channel.Channel) *DeliverSource {
+	return &DeliverSource{ch: ch, done: make(chan struct{})}
+}
+
+func (s *DeliverSource) Blocks(start *uint64) (<-chan *common.Block, error) {
+	opts := []evtclient.Option{}
+	if start != nil {
+		opts = append(opts, evtclient.WithBlockNum(*start))
+	}
+	client, err := s.ch.NewBlockEventClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event client: %w", err)
+	}
+	registration, notifier, err := client.RegisterBlockEvent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to register block event: %w", err)
+	}
+	s.mutex.Lock()
+	s.client, s.registration = client, registration
+	s.mutex.Unlock()
+
+	out := make(chan *common.Block)
+	go func() {
+		defer close(out)
+		stopped := false
+		// MUST consume all events until fabric-sdk-go closes the event channel on unregister,
+		// or the dispatcher is pended forever when the channel buffer is full.
+		for evt := range notifier {
+			if evt == nil || stopped {
+				continue
+			}
+			select {
+			case out <- evt.Block:
+			case <-s.done:
+				stopped = true
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *DeliverSource) Err() error {
+	return nil
+}
+
+// Close unregisters the block event
+func (s *DeliverSource) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.client != nil {
+			s.client.Unregister(s.registration)
+		}
+	})
+	return nil
+}
+
+// Height queries the chain height by the ledger client
+func (s *DeliverSource) Height() (uint64, error) {
+	s.mutex.Lock()
+	if s.ldgClient == nil {
+		client, err := s.ch.NewLedgerClient()
+		if err != nil {
+			s.mutex.Unlock()
+			return 0, fmt.Errorf("failed to create ledger client: %w", err)
+		}
+		s.ldgClient = client
+	}
+	client := s.ldgClient
+	s.mutex.Unlock()
+
+	info, err := client.QueryInfo()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query info: %w", err)
+	}
+	return info.BCI.Height, nil
+}
+
+// Ranger reads stored blocks in order, ex) archive.Reader, archive.FileReader and blockfile.Reader
+type Ranger interface {
+	Range(from, to uint64, fn func(*common.Block) error) error
+}
+
+var errSourceClosed = errors.New("block source closed")
+
+// RangeSource streams stored blocks by the ranger, the stream ends after the last stored block
+type RangeSource struct {
+	ranger Ranger
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func NewRangeSource(ranger Ranger) *RangeSource {
+	return &RangeSource{ranger: ranger, done: make(chan struct{})}
+}
+
+func (s *RangeSource) Blocks(start *uint64) (<-chan *common.Block, error) {
+	if s.ranger == nil {
+		return nil, errors.New("ranger is nil")
+	}
+	from := uint64(0)
+	if start != nil {
+		from = *start
+	}
+	out := make(chan *common.Block)
+	go func() {
+		defer close(out)
+		err := s.ranger.Range(from, math.MaxUint64, func(b *common.Block) error {
+			select {
+			case out <- b:
+				return nil
+			case <-s.done:
+				return errSourceClosed
+			}
+		})
+		if err != nil && !errors.Is(err, errSourceClosed) {
+			s.err = err // written before closing the channel
+		}
+	}()
+	return out, nil
+}
+
+// Height returns the height of the stored blocks if the ranger reports it, ex) archive.Reader, archive.FileReader and blockfile.Reader
+func (s *RangeSource) Height() (uint64, error) {
+	switch r := s.ranger.(type) {
+	case HeightSource:
+		return r.Height()
+	case interface{ Height() uint64 }:
+		return r.Height(), nil
+	}
+	return 0, errors.New("ranger has no height")
+}
+
+func (s *RangeSource) Err() error {
+	return s.err
+}
+
+func (s *RangeSource) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
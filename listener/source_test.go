@@ -0,0 +1,92 @@
+package listener
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+type testRanger struct {
+	last uint64
+	err  error
+}
+
+func (r *testRanger) Range(from, to uint64, fn func(*common.Block) error) error {
+	for i := from; i <= r.last && i <= to; i++ {
+		b := &common.Block{
+			Header:   &common.BlockHeader{Number: i},
+			Data:     &common.BlockData{},
+			Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {}, {}, {}}},
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return r.err
+}
+
+func Test_RangeSource(t *testing.T) {
+	listen := func(r *testRanger, options ...Option) ([]uint64, StopReason, error) {
+		nums := []uint64{}
+		handler := block.HandlerFunc(func(b *block.Block) error {
+			nums = append(nums, b.Num)
+			return nil
+		})
+		l, err := New(NewRangeSource(r), handler, options...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		err = l.Listen()
+		return nums, l.StopReason(), err
+	}
+
+	nums, reason, err := listen(&testRanger{last: 9}, WithStartBlock(3), WithEndBlock(5))
+	if err != nil || reason != StopReasonEndBlock || len(nums) != 3 || nums[0] != 3 {
+		t.Errorf("unexpected result: %v, %v, %v", nums, reason, err)
+	}
+
+	nums, reason, err = listen(&testRanger{last: 9})
+	if err != nil || reason != StopReasonClosed || len(nums) != 10 {
+		t.Errorf("unexpected result: %v, %v, %v", nums, reason, err)
+	}
+
+	failing := errors.New("corrupted")
+	nums, reason, err = listen(&testRanger{last: 2, err: failing}, WithMaxBlocks(10))
+	if !errors.Is(err, failing) || reason != StopReasonError || len(nums) != 3 {
+		t.Errorf("unexpected result: %v, %v, %v", nums, reason, err)
+	}
+
+	if _, _, err = listen(&testRanger{last: 2}, WithStopAtHeight()); err == nil {
+		t.Error("expected error without height")
+	}
+}
+
+type testHeightRanger struct {
+	testRanger
+}
+
+func (r *testHeightRanger) Height() uint64 {
+	return r.last + 1
+}
+
+func Test_RangeSourceHeight(t *testing.T) {
+	nums := []uint64{}
+	handler := block.HandlerFunc(func(b *block.Block) error {
+		nums = append(nums, b.Num)
+		return nil
+	})
+	l, err := New(NewRangeSource(&testHeightRanger{testRanger{last: 9}}), handler, WithStartBlock(7), WithStopAtHeight())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := l.Listen(); err != nil || l.StopReason() != StopReasonCaughtUp || len(nums) != 3 {
+		t.Errorf("unexpected result: %v, %v, %v", nums, l.StopReason(), err)
+	}
+
+	if _, err := NewRangeSource(&testRanger{last: 9}).Height(); err == nil {
+		t.Error("expected error of a ranger without height")
+	}
+}
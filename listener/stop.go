@@ -0,0 +1,39 @@
+package listener
+
+// StopReason describes why the listener stopped
+type StopReason int
+
+const (
+	StopReasonNone       StopReason = iota // not stopped yet
+	StopReasonSignal                       // SIGINT or SIGTERM
+	StopReasonEndBlock                     // WithEndBlock
+	StopReasonDeadline                     // WithDeadline
+	StopReasonBlockCount                   // WithMaxBlocks
+	StopReasonTxCount                      // WithMaxTxs
+	StopReasonBlockTime                    // WithBlockTimeLimit
+	StopReasonCaughtUp                     // WithStopAtHeight
+	StopReasonCondition                    // WithStopCondition
+	StopReasonError                        // error from parsing or handling blocks
+	StopReasonClosed                       // event channel closed by the event service
+)
+
+var stopReasonNames = map[StopReason]string{
+	StopReasonNone:       "none",
+	StopReasonSignal:     "signal",
+	StopReasonEndBlock:   "end_block",
+	StopReasonDeadline:   "deadline",
+	StopReasonBlockCount: "block_count",
+	StopReasonTxCount:    "tx_count",
+	StopReasonBlockTime:  "block_time",
+	StopReasonCaughtUp:   "caught_up",
+	StopReasonCondition:  "condition",
+	StopReasonError:      "error",
+	StopReasonClosed:     "closed",
+}
+
+func (r StopReason) String() string {
+	if name, ok := stopReasonNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,151 @@
+package listener
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/key-inside/patrasche/block"
+	ptesting "github.com/key-inside/patrasche/testing"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+// newTestChannel returns a fake channel of 5 blocks with 2 transactions each, block n at DefaultTime + n seconds
+func newTestChannel(t *testing.T) *ptesting.Channel {
+	blocks := []*blocktest.Block{}
+	for i := uint64(0); i < 5; i++ {
+		blocks = append(blocks, blocktest.NewBlock(i).
+			AddEndorserTx("token", "mint").
+			AddEndorserTx("token", "transfer").
+			Block())
+	}
+	ch := ptesting.NewChannel()
+	if err := ch.AddBlocks(blocktest.Chain(blocks...)...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return ch
+}
+
+func Test_StopReasons(t *testing.T) {
+	failing := errors.New("handler failed")
+	signals := make(chan os.Signal, 1)
+
+	tests := []struct {
+		name    string
+		options []Option
+		handle  func(*block.Block) error
+		reason  StopReason
+		handled int
+	}{
+		{
+			name:    "end block",
+			options: []Option{WithEndBlock(2)},
+			reason:  StopReasonEndBlock,
+			handled: 3,
+		},
+		{
+			name:    "deadline",
+			options: []Option{WithDeadline(time.Now().Add(50 * time.Millisecond))},
+			reason:  StopReasonDeadline,
+			handled: 5, // waits at the tip
+		},
+		{
+			name:    "max blocks",
+			options: []Option{WithMaxBlocks(2)},
+			reason:  StopReasonBlockCount,
+			handled: 2,
+		},
+		{
+			name:    "max txs",
+			options: []Option{WithMaxTxs(3)},
+			reason:  StopReasonTxCount,
+			handled: 2,
+		},
+		{
+			name:    "block time",
+			options: []Option{WithBlockTimeLimit(blocktest.DefaultTime.Add(1500 * time.Millisecond))},
+			reason:  StopReasonBlockTime,
+			handled: 2, // block 2 is not handled
+		},
+		{
+			name:    "stop at height",
+			options: []Option{WithStopAtHeight()},
+			reason:  StopReasonCaughtUp,
+			handled: 5,
+		},
+		{
+			name:    "caught up at start",
+			options: []Option{WithStopAtHeight(), WithStartBlock(5)},
+			reason:  StopReasonCaughtUp,
+			handled: 0,
+		},
+		{
+			name:    "condition",
+			options: []Option{WithStopCondition(func(b *block.Block) bool { return b.Num == 3 })},
+			reason:  StopReasonCondition,
+			handled: 4,
+		},
+		{
+			name: "handler error",
+			handle: func(b *block.Block) error {
+				if b.Num == 1 {
+					return failing
+				}
+				return nil
+			},
+			reason:  StopReasonError,
+			handled: 2,
+		},
+		{
+			name: "signal",
+			options: []Option{WithShutdown(func(sig os.Signal) {
+				if sig != syscall.SIGINT {
+					t.Errorf("unexpected signal: %v", sig)
+				}
+			})},
+			handle: func(b *block.Block) error {
+				if b.Num == 4 {
+					signals <- syscall.SIGINT
+				}
+				return nil
+			},
+			reason:  StopReasonSignal,
+			handled: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		handled := 0
+		handler := block.HandlerFunc(func(b *block.Block) error {
+			handled++
+			if tt.handle != nil {
+				return tt.handle(b)
+			}
+			return nil
+		})
+		var stopped StopReason
+		options := append([]Option{WithStartBlock(0), WithStop(func(r StopReason) { stopped = r })}, tt.options...)
+
+		l, err := New(newTestChannel(t).NewSource(), handler, options...)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		l.signals = signals
+		err = l.Listen()
+		if tt.reason == StopReasonError {
+			if !errors.Is(err, failing) {
+				t.Errorf("%s: expected handler error, got %v", tt.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+		}
+		if l.StopReason() != tt.reason || stopped != tt.reason {
+			t.Errorf("%s: expected %s, got %s (callback %s)", tt.name, tt.reason, l.StopReason(), stopped)
+		}
+		if handled != tt.handled {
+			t.Errorf("%s: expected %d blocks handled, got %d", tt.name, tt.handled, handled)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Package output writes command results to stdout in a structured format, separately from logs on stderr.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	JSON  Format = "json"  // an indented JSON document per result
+	JSONL Format = "jsonl" // a compact JSON line per result
+	YAML  Format = "yaml"  // YAML documents separated by '---'
+	Table Format = "table" // columns of the top-level fields, written on Flush
+	Raw   Format = "raw"   // strings and bytes as they are, ex) chaincode payloads
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSON, JSONL, YAML, Table, Raw:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format: %s", s)
+}
+
+// Printer writes results in the format, values are marshaled by their JSON tags in all formats
+type Printer struct {
+	w      io.Writer
+	format Format
+
+	mutex   sync.Mutex
+	count   int
+	columns []string
+	rows    [][]string
+}
+
+func New(w io.Writer, format Format) *Printer {
+	return &Printer{w: w, format: format}
+}
+
+func (p *Printer) Format() Format {
+	return p.format
+}
+
+func (p *Printer) Print(v interface{}) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	defer func() { p.count++ }()
+
+	if p.format == Raw {
+		switch raw := v.(type) {
+		case string:
+			return p.writeln([]byte(raw))
+		case []byte:
+			return p.writeln(raw)
+		case json.RawMessage:
+			return p.writeln(raw)
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	switch p.format {
+	case JSON:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return err
+		}
+		return p.writeln(buf.Bytes())
+	case YAML:
+		doc, err := toYAML(data)
+		if err != nil {
+			return err
+		}
+		if p.count > 0 {
+			doc = append([]byte("---\n"), doc...)
+		}
+		_, err = p.w.Write(doc)
+		return err
+	case Table:
+		return p.addRow(data)
+	}
+	return p.writeln(data) // jsonl and raw
+}
+
+func (p *Printer) writeln(data []byte) error {
+	if _, err := p.w.Write(data); err != nil {
+		return err
+	}
+	_, err := p.w.Write([]byte{'\n'})
+	return err
+}
+
+// Flush writes the buffered table, it does nothing in other formats
+func (p *Printer) Flush() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.format != Table || len(p.rows) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(p.columns, "\t")))
+	for _, row := range p.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	p.rows = nil
+	return tw.Flush()
+}
+
+// addRow MUST be called with the lock, the columns are the fields of the first result in order
+func (p *Printer) addRow(data []byte) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	fields := map[string]string{}
+	keys := []string{}
+	if len(node.Content) == 1 && node.Content[0].Kind == yaml.MappingNode {
+		m := node.Content[0]
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			key := m.Content[i].Value
+			keys = append(keys, key)
+			fields[key] = cell(m.Content[i+1])
+		}
+	} else {
+		keys = []string{"value"}
+		fields["value"] = cell(node.Content[0])
+	}
+	if p.columns == nil {
+		p.columns = keys
+	}
+	row := []string{}
+	for _, c := range p.columns {
+		row = append(row, fields[c])
+	}
+	p.rows = append(p.rows, row)
+	return nil
+}
+
+// cell returns a scalar as it is, or the compact JSON of a collection
+func cell(n *yaml.Node) string {
+	if n.Kind == yaml.ScalarNode {
+		if n.Tag == "!!null" {
+			return ""
+		}
+		return n.Value
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// toYAML converts JSON to block style YAML keeping the order of the fields
+func toYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	resetStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+func resetStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		resetStyle(c)
+	}
+}
+
+// Payload returns the JSON payload as it is, or the string of a non-JSON payload
+func Payload(data []byte) interface{} {
+	if len(data) > 0 && json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return string(data)
+}
@@ -0,0 +1,51 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+type result struct {
+	Num   uint64            `json:"num"`
+	Name  string            `json:"name"`
+	Flag  string            `json:"flag"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+func Test_Printer(t *testing.T) {
+	results := []interface{}{
+		result{Num: 1, Name: "alice", Flag: "true"},
+		result{Num: 2, Name: "bob", Attrs: map[string]string{"k": "v"}},
+	}
+	expected := map[Format]string{
+		JSONL: "{\"num\":1,\"name\":\"alice\",\"flag\":\"true\"}\n{\"num\":2,\"name\":\"bob\",\"flag\":\"\",\"attrs\":{\"k\":\"v\"}}\n",
+		YAML:  "num: 1\nname: alice\nflag: \"true\"\n---\nnum: 2\nname: bob\nflag: \"\"\nattrs:\n    k: v\n",
+		Table: "NUM  NAME   FLAG\n1    alice  true\n2    bob    \n",
+	}
+	for format, want := range expected {
+		var buf bytes.Buffer
+		p := New(&buf, format)
+		for _, r := range results {
+			if err := p.Print(r); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		p.Flush()
+		if buf.String() != want {
+			t.Errorf("%s: expected %q, got %q", format, want, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	p := New(&buf, Raw)
+	p.Print(json.RawMessage(`{"a":1}`))
+	p.Print("plain")
+	if buf.String() != "{\"a\":1}\nplain\n" {
+		t.Errorf("unexpected raw output: %q", buf.String())
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
@@ -29,11 +29,14 @@ import (
 	"github.com/key-inside/patrasche/channel"
 	"github.com/key-inside/patrasche/listener"
 	"github.com/key-inside/patrasche/logger"
+	"github.com/key-inside/patrasche/output"
+	"github.com/key-inside/patrasche/pipeline"
 )
 
 type Patrasche struct {
-	logOut io.Writer
-	logger zerolog.Logger
+	logOut  io.Writer
+	logger  zerolog.Logger
+	printer *output.Printer
 
 	envPrefix string
 	cfgName   string
@@ -76,7 +79,7 @@ func FromContext(ctx context.Context) *Patrasche {
 }
 
 func Bite(cmd *cobra.Command, options ...Option) (*Patrasche, error) {
-	out := cmd.OutOrStdout()
+	out := cmd.ErrOrStderr() // stdout is for results
 	p := &Patrasche{
 		logOut:    out,
 		logger:    logger.New("patrasche", out, zerolog.InfoLevel),
@@ -125,6 +128,8 @@ func Bite(cmd *cobra.Command, options ...Option) (*Patrasche, error) {
 		}
 	}
 
+	cmd.PersistentFlags().AddFlagSet(newOutputFlagSet())
+
 	if err := overrideMethods(cmd); err != nil {
 		return nil, fmt.Errorf("failed to override command's methods: %w", err)
 	}
@@ -144,6 +149,11 @@ func (p *Patrasche) Logger() zerolog.Logger {
 	return p.logger
 }
 
+// Printer returns the result printer of the --output flag, nil if the flag is not set
+func (p *Patrasche) Printer() *output.Printer {
+	return p.printer
+}
+
 func (p *Patrasche) SetLogLevel(lv string) {
 	zLv, _ := zerolog.ParseLevel(lv)
 	p.logger = p.logger.Level(zLv)
@@ -172,6 +182,13 @@ func newDefaultFlagSet(namespace string) *pflag.FlagSet {
 	return fset
 }
 
+func newOutputFlagSet() *pflag.FlagSet {
+	fset := pflag.NewFlagSet("output", pflag.ContinueOnError)
+	fset.StringP("output", "o", "", "result format written to stdout: json, jsonl, yaml, table or raw")
+	fset.BoolP("quiet", "q", false, "suppress the logo and version banner")
+	return fset
+}
+
 func overrideMethods(cmd *cobra.Command) error {
 	tmpl := template.New("version")
 	tmpl, err := tmpl.Parse(cmd.VersionTemplate())
@@ -182,12 +199,22 @@ func overrideMethods(cmd *cobra.Command) error {
 
 	persistentPreRunE := cmd.PersistentPreRunE
 	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) (err error) {
-		out := cmd.OutOrStdout()
-		PrintLogo(out)
-		printVersion(out, cmd)
-		fmt.Fprintln(out)
+		out := cmd.ErrOrStderr()
+		if quiet, _ := cmd.Flags().GetBool("quiet"); !quiet {
+			PrintLogo(out)
+			printVersion(out, cmd)
+			fmt.Fprintln(out)
+		}
 
 		if p := Biter(cmd); p != nil {
+			if str, _ := cmd.Flags().GetString("output"); str != "" {
+				format, err := output.ParseFormat(str)
+				if err != nil {
+					return err
+				}
+				p.printer = output.New(cmd.OutOrStdout(), format)
+			}
+
 			p.logger.Debug().Str("command", cmd.CommandPath()).
 				Dict("runtime", zerolog.Dict().
 					Str("os", runtime.GOOS).
@@ -219,7 +246,14 @@ func overrideMethods(cmd *cobra.Command) error {
 		} else if cmd.PersistentPostRun != nil {
 			cmd.PersistentPostRun(cmd, args)
 		}
-		fmt.Fprintln(cmd.OutOrStdout())
+		if p := Biter(cmd); p != nil && p.printer != nil {
+			if e := p.printer.Flush(); err == nil {
+				err = e
+			}
+		}
+		if quiet, _ := cmd.Flags().GetBool("quiet"); !quiet {
+			fmt.Fprintln(cmd.ErrOrStderr())
+		}
 		return err
 	}
 
@@ -351,13 +385,27 @@ func (p *Patrasche) ListenBlock(handler block.Handler, options ...listener.Optio
 	}
 	defer ch.Close()
 
-	l, err := listener.New(ch, handler, options...)
+	l, err := listener.New(listener.NewDeliverSource(ch), handler, options...)
 	if err != nil {
 		return fmt.Errorf("failed to create listener: %w", err)
 	}
 	return l.Listen()
 }
 
+// NewPipeline builds the handler pipeline described in the config with the default registry.
+// Register custom factories to the pipeline package before calling it.
+// Canceling ctx stops waiting for retries, ex) on shutdown.
+func (p *Patrasche) NewPipeline(ctx context.Context) (*pipeline.Pipeline, error) {
+	return p.NewPipelineWithRegistry(ctx, pipeline.DefaultRegistry())
+}
+
+// NewPipelineWithRegistry builds the handler pipeline described in the config with the registry,
+// ex) a registry of a command having its own factories
+func (p *Patrasche) NewPipelineWithRegistry(ctx context.Context, r *pipeline.Registry) (*pipeline.Pipeline, error) {
+	logger := p.logger.With().Str("caller", "pipeline").Logger()
+	return r.Build(p.config.Pipeline, &pipeline.Env{Logger: &logger, Context: ctx})
+}
+
 type Option func(*Patrasche) error
 
 func WithEnvPrefix(prefix string) Option {
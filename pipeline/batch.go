@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"errors"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// newBatcher returns a block.Batcher passing transactions of each block through the tx stages
+// and writing the passed ones to the sinks at once, bulk sinks get the batch by HandleBatch.
+// The checkpoint is the next handler of the batcher, so it advances after the batch is written.
+// The retry policy retries writing the batch, dead-letters are not supported.
+func newBatcher(cfg Config, sinks []tx.Handler, txMws []tx.Middleware, checkpoint block.Middleware, env *Env) (*block.Batcher, error) {
+	write := func(batch *block.Batch) error {
+		for _, s := range sinks {
+			if bh, ok := s.(block.BatchHandler); ok {
+				if err := bh.HandleBatch(batch); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, t := range batch.Txs() {
+				if err := s.Handle(t); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if cfg.ErrorPolicy != nil {
+		if cfg.ErrorPolicy.DeadLetter != nil {
+			return nil, errors.New("dead-letter is not supported with the batcher")
+		}
+		if cfg.ErrorPolicy.Retry != nil {
+			policy, err := retryPolicy(*cfg.ErrorPolicy.Retry, env)
+			if err != nil {
+				return nil, err
+			}
+			next := write
+			write = func(batch *block.Batch) error {
+				return policy.Do(env.Context, func() error { return next(batch) })
+			}
+		}
+	}
+
+	// collects transactions passing the tx stages
+	var passed []*tx.Tx
+	stdHandler, err := block.NewStdHandler(tx.Chain(tx.HandlerFunc(func(t *tx.Tx) error {
+		passed = append(passed, t)
+		return nil
+	}), txMws...))
+	if err != nil {
+		return nil, err
+	}
+	handleBatch := block.BatchHandlerFunc(func(batch *block.Batch) error {
+		filtered := &block.Batch{Bytes: batch.Bytes}
+		for _, b := range batch.Blocks {
+			passed = nil
+			if err := stdHandler.Handle(b); err != nil {
+				return err
+			}
+			fb := *b
+			fb.Txs = passed
+			filtered.Blocks = append(filtered.Blocks, &fb)
+		}
+		return write(filtered)
+	})
+
+	var next block.Handler
+	if checkpoint != nil {
+		next = checkpoint(block.HandlerFunc(func(*block.Block) error { return nil }))
+	}
+
+	c := cfg.Batcher
+	opts := []block.BatchOption{block.WithBatchOnError(func(err error) {
+		env.Logger.Error().Err(err).Msg("failed to write batch")
+	})}
+	if c.Blocks > 0 {
+		opts = append(opts, block.WithBatchBlocks(c.Blocks))
+	}
+	if c.Txs > 0 {
+		opts = append(opts, block.WithBatchTxs(c.Txs))
+	}
+	if c.Bytes > 0 {
+		opts = append(opts, block.WithBatchBytes(c.Bytes))
+	}
+	if c.Window > 0 {
+		opts = append(opts, block.WithBatchWindow(c.Window))
+	}
+	return block.NewBatcher(next, handleBatch, opts...)
+}
@@ -0,0 +1,391 @@
+package pipeline
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+
+	"github.com/key-inside/patrasche/archive"
+	patrasche_aws "github.com/key-inside/patrasche/aws"
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/deadletter"
+	"github.com/key-inside/patrasche/sink"
+	"github.com/key-inside/patrasche/tx"
+)
+
+func registerBuiltins(r *Registry) {
+	// block
+	r.RegisterBlock("logger", func(params Params, env *Env) (block.Middleware, error) {
+		return block.StdLogger(env.Logger), nil
+	})
+	r.RegisterBlock("hashFilter", func(params Params, env *Env) (block.Middleware, error) {
+		pattern, err := params.RequiredString("pattern")
+		if err != nil {
+			return nil, err
+		}
+		return block.HashFilter(pattern, block.NewHashFilteredLoggingAction(env.Logger)), nil
+	})
+	r.RegisterBlock("blockNumberFile", func(params Params, env *Env) (block.Middleware, error) {
+		path, err := params.RequiredString("path")
+		if err != nil {
+			return nil, err
+		}
+		env.OnCheckpoint(func() (uint64, bool, error) {
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				return 0, false, nil
+			}
+			if err != nil {
+				return 0, false, err
+			}
+			bn, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				return 0, false, fmt.Errorf("invalid block number file '%s': %w", path, err)
+			}
+			return bn, true, nil
+		})
+		return block.BlockNumberFileWriter(path), nil
+	})
+	r.RegisterBlock("blockNumberDynamoDB", func(params Params, env *Env) (block.Middleware, error) {
+		table, err := params.RequiredString("table")
+		if err != nil {
+			return nil, err
+		}
+		key, err := params.StringMap("key") // ex) {id: "my-listener"}
+		if err != nil {
+			return nil, err
+		}
+		attr := params.String("attribute", "block")
+		itemFactory := func(b *block.Block) any {
+			item := map[string]any{attr: b.Num}
+			for k, v := range key {
+				item[k] = v
+			}
+			return item
+		}
+		env.OnCheckpoint(func() (uint64, bool, error) {
+			itemKey := map[string]any{}
+			for k, v := range key {
+				itemKey[k] = v
+			}
+			item, err := patrasche_aws.GetItemFromDynamoDB(AWSConfig(params), table, itemKey)
+			if err != nil {
+				return 0, false, err
+			}
+			av, ok := item[attr]
+			if !ok {
+				return 0, false, nil
+			}
+			var bn uint64
+			if err := attributevalue.Unmarshal(av, &bn); err != nil {
+				return 0, false, fmt.Errorf("invalid block number attribute '%s': %w", attr, err)
+			}
+			return bn, true, nil
+		})
+		return block.BlockNumberDynamoDBWriter(AWSConfig(params), table, itemFactory), nil
+	})
+	r.RegisterBlock("archive", func(params Params, env *Env) (block.Middleware, error) {
+		location, err := params.RequiredString("location") // directory path or s3://bucket/prefix
+		if err != nil {
+			return nil, err
+		}
+		store, err := archive.OpenStore(location, func() aws.Config { return AWSConfig(params) })
+		if err != nil {
+			return nil, err
+		}
+		opts := []archive.WriterOption{}
+		if params.Has("segmentSize") {
+			size, err := params.Int("segmentSize", 0)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, archive.WithSegmentSize(size))
+		}
+		w, err := archive.NewWriter(nil, store, opts...)
+		if err != nil {
+			return nil, err
+		}
+		env.OnFlush(w.Flush)
+		env.OnClose(w.Close)
+		// blocks buffered in a segment are lost on a crash, the checkpoint may be ahead of them
+		env.OnCheckpoint(func() (uint64, bool, error) {
+			last, ok := w.LastBlock()
+			return last, ok, nil
+		})
+		env.OnResume(func(start uint64) uint64 {
+			if last, ok := w.LastBlock(); ok && last+1 < start {
+				return last + 1
+			}
+			return start
+		})
+		return func(next block.Handler) block.Handler {
+			return block.HandlerFunc(func(b *block.Block) error {
+				if err := w.Handle(b); err != nil {
+					return err
+				}
+				return next.Handle(b)
+			})
+		}, nil
+	})
+	r.RegisterBlock("archiveFile", func(params Params, env *Env) (block.Middleware, error) {
+		path, err := params.RequiredString("path")
+		if err != nil {
+			return nil, err
+		}
+		w, err := archive.NewFileWriter(nil, path)
+		if err != nil {
+			return nil, err
+		}
+		env.OnFlush(w.Flush)
+		env.OnClose(w.Close)
+		return func(next block.Handler) block.Handler {
+			return block.HandlerFunc(func(b *block.Block) error {
+				if err := w.Handle(b); err != nil {
+					return err
+				}
+				return next.Handle(b)
+			})
+		}, nil
+	})
+	// the SQL sink writes whole blocks with its own checkpoint, so it is a block stage
+	r.RegisterBlock("sql", newSQL)
+
+	// tx
+	r.RegisterTx("logger", func(params Params, env *Env) (tx.Middleware, error) {
+		return tx.StdLogger(env.Logger), nil
+	})
+	r.RegisterTx("hashFilter", func(params Params, env *Env) (tx.Middleware, error) {
+		pattern, err := params.RequiredString("pattern")
+		if err != nil {
+			return nil, err
+		}
+		return tx.HashFilter(pattern, tx.NewHashFilteredLoggingAction(env.Logger)), nil
+	})
+	r.RegisterTx("validEndorser", func(params Params, env *Env) (tx.Middleware, error) {
+		return tx.ValidEndorserFilter(tx.NewValidEndorserFilteredLoggingAction(env.Logger)), nil
+	})
+
+	// sinks
+	r.RegisterSink("logger", func(params Params, env *Env) (tx.Handler, error) {
+		return tx.NewStdLogger(nil, env.Logger), nil
+	})
+	r.RegisterSink("dynamodb", func(params Params, env *Env) (tx.Handler, error) {
+		table, err := params.RequiredString("table")
+		if err != nil {
+			return nil, err
+		}
+		opts := []sink.DynamoDBOption{sink.WithDynamoDBContext(env.Context)}
+		if key := params.String("key", ""); key != "" {
+			opts = append(opts, sink.WithDynamoDBKey(key))
+		}
+		conditional, err := params.Bool("conditional", false)
+		if err != nil {
+			return nil, err
+		}
+		if conditional {
+			opts = append(opts, sink.WithDynamoDBConditional())
+		}
+		return sink.NewDynamoDB(AWSConfig(params), table, opts...)
+	})
+	r.RegisterSink("webhook", func(params Params, env *Env) (tx.Handler, error) {
+		return newWebhook(params, env)
+	})
+	r.RegisterSink("sqs", func(params Params, env *Env) (tx.Handler, error) {
+		queueURL, err := params.RequiredString("queueUrl")
+		if err != nil {
+			return nil, err
+		}
+		opts, err := publishOptions(params, env)
+		if err != nil {
+			return nil, err
+		}
+		return sink.NewSQS(AWSConfig(params), queueURL, opts...)
+	})
+	r.RegisterSink("sns", func(params Params, env *Env) (tx.Handler, error) {
+		topicARN, err := params.RequiredString("topicArn")
+		if err != nil {
+			return nil, err
+		}
+		opts, err := publishOptions(params, env)
+		if err != nil {
+			return nil, err
+		}
+		return sink.NewSNS(AWSConfig(params), topicARN, opts...)
+	})
+	r.RegisterSink("kinesis", func(params Params, env *Env) (tx.Handler, error) {
+		stream, err := params.RequiredString("stream")
+		if err != nil {
+			return nil, err
+		}
+		opts, err := publishOptions(params, env)
+		if err != nil {
+			return nil, err
+		}
+		return sink.NewKinesis(AWSConfig(params), stream, opts...)
+	})
+
+	// dead-letters
+	r.RegisterDeadLetter("file", func(params Params, env *Env) (deadletter.Sink, error) {
+		path, err := params.RequiredString("path")
+		if err != nil {
+			return nil, err
+		}
+		sink, err := deadletter.NewFileSink(path)
+		if err != nil {
+			return nil, err
+		}
+		env.OnClose(sink.Close)
+		return sink, nil
+	})
+	r.RegisterDeadLetter("dynamodb", func(params Params, env *Env) (deadletter.Sink, error) {
+		table, err := params.RequiredString("table")
+		if err != nil {
+			return nil, err
+		}
+		return deadletter.NewDynamoDBSink(AWSConfig(params), table), nil
+	})
+}
+
+// newWebhook creates a webhook sink with 'routes' (url, events, chaincode, eventName, headers),
+// 'secret', 'timeout' and 'concurrency' parameters
+func newWebhook(params Params, env *Env) (*sink.Webhook, error) {
+	routeParams, err := params.ParamsSlice("routes")
+	if err != nil {
+		return nil, err
+	}
+	if url := params.String("url", ""); url != "" { // single route shorthand
+		routeParams = append(routeParams, params)
+	}
+	routes := []sink.WebhookRoute{}
+	for _, rp := range routeParams {
+		url, err := rp.RequiredString("url")
+		if err != nil {
+			return nil, err
+		}
+		route := sink.WebhookRoute{URL: url, Chaincode: rp.String("chaincode", "")}
+		if route.Events, err = rp.Bool("events", false); err != nil {
+			return nil, err
+		}
+		if pattern := rp.String("eventName", ""); pattern != "" {
+			if route.EventName, err = regexp.Compile(pattern); err != nil {
+				return nil, err
+			}
+		}
+		if route.Headers, err = rp.StringMap("headers"); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	opts := []sink.WebhookOption{sink.WithWebhookContext(env.Context)}
+	if secret := params.String("secret", ""); secret != "" {
+		opts = append(opts, sink.WithWebhookSecret([]byte(secret)))
+	}
+	if params.Has("timeout") {
+		d, err := params.Duration("timeout", 0)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sink.WithWebhookTimeout(d))
+	}
+	if params.Has("concurrency") {
+		n, err := params.Int("concurrency", 0)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sink.WithWebhookConcurrency(n))
+	}
+	return sink.NewWebhook(routes, opts...)
+}
+
+// publishOptions converts 'events' (bool) and 'key' (txId or chaincode) parameters
+func publishOptions(params Params, env *Env) ([]sink.PublishOption, error) {
+	opts := []sink.PublishOption{sink.WithPublishContext(env.Context)}
+	events, err := params.Bool("events", false)
+	if err != nil {
+		return nil, err
+	}
+	if events {
+		opts = append(opts, sink.WithPublishEvents())
+	}
+	switch key := strings.ToLower(params.String("key", "")); key {
+	case "":
+	case "txid":
+		opts = append(opts, sink.WithPublishKey(sink.TxIDKey))
+	case "chaincode":
+		opts = append(opts, sink.WithPublishKey(sink.ChaincodeKey))
+	default:
+		return nil, fmt.Errorf("unknown key: %s", key)
+	}
+	return opts, nil
+}
+
+// AWSConfig returns the default AWS config with the optional 'endpoint' and 'region' parameters
+func AWSConfig(params Params) aws.Config {
+	opts := []func(*config.LoadOptions) error{}
+	if region := params.String("region", ""); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if endpoint := params.String("endpoint", ""); endpoint != "" {
+		opts = append(opts, patrasche_aws.WithEndpoint(params.String("region", ""), endpoint))
+	}
+	return patrasche_aws.DefaultConfig(opts...)
+}
+
+// newSQL creates a SQL sink stage with 'driver', 'dsn', 'dialect' (default is the driver),
+// 'tablePrefix' and 'checkpointName', the schema is migrated on creation.
+// The stage reports its checkpoint, so the pipeline resumes from the next block of it.
+// The driver must be imported by the application. ex) _ "github.com/lib/pq"
+func newSQL(params Params, env *Env) (block.Middleware, error) {
+	driver, err := params.RequiredString("driver")
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := params.RequiredString("dsn")
+	if err != nil {
+		return nil, err
+	}
+	dialect, err := sink.DialectByName(params.String("dialect", driver))
+	if err != nil {
+		return nil, err
+	}
+	opts := []sink.SQLOption{}
+	if params.Has("tablePrefix") {
+		opts = append(opts, sink.WithSQLTablePrefix(params.String("tablePrefix", "")))
+	}
+	if name := params.String("checkpointName", ""); name != "" {
+		opts = append(opts, sink.WithSQLCheckpointName(name))
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	s, err := sink.NewSQL(db, dialect, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.Migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	env.OnClose(db.Close)
+	env.OnCheckpoint(s.Checkpoint) // committed with the blocks, resuming from it makes blocks processed exactly once
+	return func(next block.Handler) block.Handler {
+		return block.HandlerFunc(func(b *block.Block) error {
+			if err := s.Handle(b); err != nil {
+				return err
+			}
+			return next.Handle(b)
+		})
+	}, nil
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// Params are the parameters of a stage.
+// Keys are case-insensitive since viper lowercases config keys.
+type Params map[string]any
+
+func (p Params) get(key string) (any, bool) {
+	if v, ok := p[key]; ok {
+		return v, true
+	}
+	key = strings.ToLower(key)
+	for k, v := range p {
+		if strings.ToLower(k) == key {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Has reports whether the key is set
+func (p Params) Has(key string) bool {
+	_, ok := p.get(key)
+	return ok
+}
+
+// String returns the string value of the key or the default value
+func (p Params) String(key, def string) string {
+	if v, ok := p.get(key); ok {
+		return cast.ToString(v)
+	}
+	return def
+}
+
+// RequiredString returns the string value of the key or an error if it is not set or empty
+func (p Params) RequiredString(key string) (string, error) {
+	if s := p.String(key, ""); s != "" {
+		return s, nil
+	}
+	return "", fmt.Errorf("parameter '%s' is required", key)
+}
+
+func (p Params) Int(key string, def int) (int, error) {
+	if v, ok := p.get(key); ok {
+		return cast.ToIntE(v)
+	}
+	return def, nil
+}
+
+func (p Params) Uint64(key string, def uint64) (uint64, error) {
+	if v, ok := p.get(key); ok {
+		return cast.ToUint64E(v)
+	}
+	return def, nil
+}
+
+func (p Params) Float(key string, def float64) (float64, error) {
+	if v, ok := p.get(key); ok {
+		return cast.ToFloat64E(v)
+	}
+	return def, nil
+}
+
+func (p Params) Bool(key string, def bool) (bool, error) {
+	if v, ok := p.get(key); ok {
+		return cast.ToBoolE(v)
+	}
+	return def, nil
+}
+
+// Duration accepts duration strings like '1m30s' and numbers as nanoseconds
+func (p Params) Duration(key string, def time.Duration) (time.Duration, error) {
+	if v, ok := p.get(key); ok {
+		return cast.ToDurationE(v)
+	}
+	return def, nil
+}
+
+func (p Params) StringSlice(key string) ([]string, error) {
+	if v, ok := p.get(key); ok {
+		return cast.ToStringSliceE(v)
+	}
+	return nil, nil
+}
+
+func (p Params) StringMap(key string) (map[string]string, error) {
+	if v, ok := p.get(key); ok {
+		return cast.ToStringMapStringE(v)
+	}
+	return nil, nil
+}
+
+// Params returns the nested parameters of the key
+func (p Params) Params(key string) (Params, error) {
+	if v, ok := p.get(key); ok {
+		m, err := cast.ToStringMapE(v)
+		if err != nil {
+			return nil, err
+		}
+		return Params(m), nil
+	}
+	return Params{}, nil
+}
+
+// ParamsSlice returns the list of nested parameters of the key
+func (p Params) ParamsSlice(key string) ([]Params, error) {
+	v, ok := p.get(key)
+	if !ok {
+		return nil, nil
+	}
+	list, err := cast.ToSliceE(v)
+	if err != nil {
+		return nil, err
+	}
+	ps := []Params{}
+	for _, item := range list {
+		m, err := cast.ToStringMapE(item)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, Params(m))
+	}
+	return ps, nil
+}
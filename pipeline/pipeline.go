@@ -0,0 +1,339 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// Stage is a named handler with parameters
+type Stage struct {
+	Name   string `mapstructure:""`
+	Params Params `mapstructure:""`
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:""`
+	InitialBackoff time.Duration `mapstructure:""`
+	MaxBackoff     time.Duration `mapstructure:""`
+	Multiplier     float64       `mapstructure:""`
+	Jitter         *float64      `mapstructure:""`
+}
+
+// ErrorPolicy wraps the sinks with retry and dead-letter handlers
+type ErrorPolicy struct {
+	Retry      *RetryConfig `mapstructure:""`
+	DeadLetter *Stage       `mapstructure:""`
+}
+
+// BatcherConfig hands transactions of blocks to the sinks at once, see block.Batcher.
+// Zero values are the defaults of block.NewBatcher.
+type BatcherConfig struct {
+	Blocks int           `mapstructure:""`
+	Txs    int           `mapstructure:""`
+	Bytes  int           `mapstructure:""`
+	Window time.Duration `mapstructure:""`
+}
+
+// Config describes a pipeline.
+// Blocks pass through the block stages, then transactions pass through the tx stages to the sinks.
+// The checkpoint advances after the block is handled, or after the batch is written to the sinks with the batcher.
+type Config struct {
+	Checkpoint  *Stage         `mapstructure:""`
+	Block       []Stage        `mapstructure:""`
+	Tx          []Stage        `mapstructure:""`
+	Sinks       []Stage        `mapstructure:""`
+	Batcher     *BatcherConfig `mapstructure:""`
+	ErrorPolicy *ErrorPolicy   `mapstructure:""`
+}
+
+// IsEmpty reports whether the config has no stage
+func (c Config) IsEmpty() bool {
+	return c.Checkpoint == nil && len(c.Block) == 0 && len(c.Tx) == 0 && len(c.Sinks) == 0
+}
+
+// Pipeline is a block handler built from the config
+type Pipeline struct {
+	block.Handler
+
+	replay      block.Handler
+	tx          tx.Handler
+	flushers    []func() error
+	closers     []func() error
+	checkpoints []func() (uint64, bool, error)
+	resumers    []func(start uint64) uint64
+}
+
+// ReplayHandler returns the handler of the block stages, the tx stages and the sinks without the checkpoint and the batcher,
+// ex) replaying dead-letters or archived blocks doesn't move the checkpoint back
+func (p *Pipeline) ReplayHandler() block.Handler {
+	return p.replay
+}
+
+// TxHandler returns the handler of the tx stages and the sinks with the error policy, ex) replaying tx dead-letters
+func (p *Pipeline) TxHandler() tx.Handler {
+	return p.tx
+}
+
+// Checkpoint returns the last block handled by all stages reporting it (Env.OnCheckpoint),
+// ok is false if no stage has handled any block
+func (p *Pipeline) Checkpoint() (blockNum uint64, ok bool, err error) {
+	for _, f := range p.checkpoints {
+		bn, has, err := f()
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+		if has && (!ok || bn < blockNum) {
+			blockNum, ok = bn, true
+		}
+	}
+	return blockNum, ok, nil
+}
+
+// StartBlock returns the block to start listening from, the start block or the next block of the checkpoint if start is nil,
+// and it is passed through Resume. ok is false if start is nil and there is no checkpoint, then listen from the newest block.
+func (p *Pipeline) StartBlock(start *uint64) (blockNum uint64, ok bool, err error) {
+	if start != nil {
+		return p.Resume(*start), true, nil
+	}
+	bn, ok, err := p.Checkpoint()
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return p.Resume(bn + 1), true, nil
+}
+
+// Resume returns the block to start listening from, the start block (ex, the checkpoint + 1)
+// or an earlier block that a handler has to handle again
+func (p *Pipeline) Resume(start uint64) uint64 {
+	for _, f := range p.resumers {
+		if bn := f(start); bn < start {
+			start = bn
+		}
+	}
+	return start
+}
+
+// Flush flushes buffers of the handlers, the listener calls it when listening is finished.
+// Flushers in the handler chain are flushed before the ones registered by Env.OnFlush.
+func (p *Pipeline) Flush() error {
+	fs := p.flushers
+	if f, ok := p.Handler.(block.Flusher); ok {
+		fs = append([]func() error{f.Flush}, fs...)
+	}
+	return callAll(fs, false)
+}
+
+// Close closes resources opened by factories, it should be called after listening
+func (p *Pipeline) Close() error {
+	return callAll(p.closers, true)
+}
+
+func callAll(fs []func() error, reverse bool) error {
+	var errs []string
+	for i := range fs {
+		if reverse {
+			i = len(fs) - 1 - i
+		}
+		if err := fs[i](); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Build builds a pipeline with the default registry
+func Build(cfg Config, env *Env) (*Pipeline, error) {
+	return defaultRegistry.Build(cfg, env)
+}
+
+func (r *Registry) Build(cfg Config, env *Env) (pl *Pipeline, err error) {
+	if env == nil {
+		env = &Env{}
+	}
+	if env.Logger == nil {
+		logger := zerolog.Nop()
+		env.Logger = &logger
+	}
+	if env.Context == nil {
+		env.Context = context.Background()
+	}
+	defer func() {
+		if err != nil {
+			(&Pipeline{closers: env.closers}).Close()
+			env.closers = nil
+		}
+	}()
+
+	// sinks
+	sinks := []tx.Handler{}
+	for i, stage := range cfg.Sinks {
+		f, err := r.sink(stage.Name)
+		if err != nil {
+			return nil, err
+		}
+		h, err := f(stage.Params, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sink #%d '%s': %w", i, stage.Name, err)
+		}
+		sinks = append(sinks, h)
+	}
+
+	// tx stages + error policy
+	txMws := []tx.Middleware{}
+	for i, stage := range cfg.Tx {
+		f, err := r.tx(stage.Name)
+		if err != nil {
+			return nil, err
+		}
+		mw, err := f(stage.Params, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tx handler #%d '%s': %w", i, stage.Name, err)
+		}
+		txMws = append(txMws, mw)
+	}
+
+	// checkpoint + block stages
+	var checkpoint block.Middleware
+	if cfg.Checkpoint != nil {
+		f, err := r.block(cfg.Checkpoint.Name)
+		if err != nil {
+			return nil, err
+		}
+		checkpoint, err = f(cfg.Checkpoint.Params, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create checkpoint '%s': %w", cfg.Checkpoint.Name, err)
+		}
+	}
+	blockMws := []block.Middleware{}
+	for i, stage := range cfg.Block {
+		f, err := r.block(stage.Name)
+		if err != nil {
+			return nil, err
+		}
+		mw, err := f(stage.Params, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create block handler #%d '%s': %w", i, stage.Name, err)
+		}
+		blockMws = append(blockMws, mw)
+	}
+
+	var batcher *block.Batcher
+	if cfg.Batcher != nil {
+		batcher, err = newBatcher(cfg, sinks, txMws, checkpoint, env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// tx stages + error policy + sinks, transactions are handed to it one by one without the batcher
+	if cfg.ErrorPolicy != nil {
+		mws, err := r.errorPolicy(*cfg.ErrorPolicy, env)
+		if err != nil {
+			return nil, err
+		}
+		txMws = append(txMws, mws...)
+	}
+	var sink tx.Handler
+	if len(sinks) == 1 {
+		sink = sinks[0]
+	} else {
+		sink = tx.Tee(sinks...)
+	}
+	txHandler := tx.Chain(sink, txMws...)
+	stdHandler, err := block.NewStdHandler(txHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	var handler block.Handler
+	if batcher != nil {
+		handler = block.Chain(batcher, blockMws...)
+	} else if checkpoint != nil {
+		handler = block.Chain(stdHandler, append([]block.Middleware{afterHandled(checkpoint)}, blockMws...)...)
+	} else {
+		handler = block.Chain(stdHandler, blockMws...)
+	}
+
+	return &Pipeline{
+		Handler:     handler,
+		replay:      block.Chain(stdHandler, blockMws...),
+		tx:          txHandler,
+		flushers:    env.flushers,
+		closers:     env.closers,
+		checkpoints: env.checkpoints,
+		resumers:    env.resumers,
+	}, nil
+}
+
+// afterHandled applies the checkpoint after the next handler handles the block,
+// so the checkpoint is the last handled block
+func afterHandled(checkpoint block.Middleware) block.Middleware {
+	return func(next block.Handler) block.Handler {
+		cp := checkpoint(block.HandlerFunc(func(*block.Block) error { return nil }))
+		return block.HandlerFunc(func(b *block.Block) error {
+			if err := next.Handle(b); err != nil {
+				return err
+			}
+			return cp.Handle(b)
+		})
+	}
+}
+
+func (r *Registry) errorPolicy(cfg ErrorPolicy, env *Env) ([]tx.Middleware, error) {
+	mws := []tx.Middleware{}
+	if cfg.DeadLetter != nil {
+		f, err := r.deadLetter(cfg.DeadLetter.Name)
+		if err != nil {
+			return nil, err
+		}
+		sink, err := f(cfg.DeadLetter.Params, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dead-letter sink '%s': %w", cfg.DeadLetter.Name, err)
+		}
+		mws = append(mws, tx.DeadLetter(sink))
+	}
+	if cfg.Retry != nil {
+		policy, err := retryPolicy(*cfg.Retry, env)
+		if err != nil {
+			return nil, err
+		}
+		mws = append(mws, tx.Retry(env.Context, policy))
+	}
+	return mws, nil
+}
+
+func retryPolicy(cfg RetryConfig, env *Env) (*retry.Policy, error) {
+	opts := []retry.Option{}
+	if cfg.MaxAttempts > 0 {
+		opts = append(opts, retry.WithMaxAttempts(cfg.MaxAttempts))
+	}
+	if cfg.InitialBackoff > 0 {
+		max := cfg.MaxBackoff
+		if max < cfg.InitialBackoff {
+			max = cfg.InitialBackoff
+		}
+		opts = append(opts, retry.WithBackoff(cfg.InitialBackoff, max))
+	}
+	if cfg.Multiplier > 0 {
+		opts = append(opts, retry.WithMultiplier(cfg.Multiplier))
+	}
+	if cfg.Jitter != nil {
+		opts = append(opts, retry.WithJitter(*cfg.Jitter))
+	}
+	opts = append(opts, retry.WithOnRetry(func(attempt int, err error, wait time.Duration) {
+		env.Logger.Warn().Err(err).Int("attempt", attempt).Dur("wait", wait).Msg("retry")
+	}))
+	return retry.New(opts...)
+}
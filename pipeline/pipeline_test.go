@@ -0,0 +1,368 @@
+package pipeline
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/spf13/viper"
+	_ "modernc.org/sqlite"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/sink"
+	"github.com/key-inside/patrasche/testing/blocktest"
+	"github.com/key-inside/patrasche/tx"
+)
+
+const testConfig = `
+pipeline:
+  block:
+    - name: hashFilter
+      params:
+        pattern: "^"
+  tx:
+    - name: counter
+      params:
+        prefix: first
+    - name: counter
+      params:
+        prefix: second
+  sinks:
+    - name: collect
+  errorPolicy:
+    retry:
+      maxAttempts: 2
+      initialBackoff: 1ms
+`
+
+func Test_BuildFromConfig(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(testConfig)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var cfg Config
+	if err := v.UnmarshalKey("pipeline", &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	trace := []string{}
+	failures := 1
+	r := NewRegistry()
+	r.RegisterTx("Counter", func(params Params, env *Env) (tx.Middleware, error) {
+		prefix := params.String("Prefix", "")
+		return func(next tx.Handler) tx.Handler {
+			return tx.HandlerFunc(func(t *tx.Tx) error {
+				trace = append(trace, prefix)
+				return next.Handle(t)
+			})
+		}, nil
+	})
+	r.RegisterSink("collect", func(params Params, env *Env) (tx.Handler, error) {
+		return tx.HandlerFunc(func(t *tx.Tx) error {
+			if failures > 0 {
+				failures--
+				return errors.New("transient") // retried by the error policy
+			}
+			trace = append(trace, "sink")
+			return nil
+		}), nil
+	})
+
+	pl, err := r.Build(cfg, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pl.Close()
+
+	b := &block.Block{
+		Block: &common.Block{Header: &common.BlockHeader{}},
+		Hash:  []byte{0xab},
+		Txs:   []*tx.Tx{{Header: &common.ChannelHeader{TxId: "abcd"}}},
+	}
+	if err := pl.Handle(b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "first,second,sink"
+	if got := strings.Join(trace, ","); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func Test_BuildUnknownStage(t *testing.T) {
+	_, err := Build(Config{Sinks: []Stage{{Name: "nothing"}}}, nil)
+	if err == nil {
+		t.Error("expected unknown sink error")
+	}
+}
+
+type testBatchSink struct {
+	batches [][]string
+}
+
+func (s *testBatchSink) Handle(t *tx.Tx) error {
+	return errors.New("must be written by HandleBatch")
+}
+
+func (s *testBatchSink) HandleBatch(batch *block.Batch) error {
+	ids := []string{}
+	for _, t := range batch.Txs() {
+		ids = append(ids, t.ID())
+	}
+	s.batches = append(s.batches, ids)
+	return nil
+}
+
+func Test_BuildBatcher(t *testing.T) {
+	sink := &testBatchSink{}
+	checkpoints := []uint64{}
+	r := NewRegistry()
+	r.RegisterBlock("checkpoint", func(params Params, env *Env) (block.Middleware, error) {
+		return func(next block.Handler) block.Handler {
+			return block.HandlerFunc(func(b *block.Block) error {
+				checkpoints = append(checkpoints, b.Num)
+				return next.Handle(b)
+			})
+		}, nil
+	})
+	r.RegisterTx("skipOdd", func(params Params, env *Env) (tx.Middleware, error) {
+		return func(next tx.Handler) tx.Handler {
+			return tx.HandlerFunc(func(t *tx.Tx) error {
+				if t.Seq%2 == 1 {
+					return nil
+				}
+				return next.Handle(t)
+			})
+		}, nil
+	})
+	r.RegisterSink("batch", func(params Params, env *Env) (tx.Handler, error) {
+		return sink, nil
+	})
+
+	pl, err := r.Build(Config{
+		Checkpoint: &Stage{Name: "checkpoint"},
+		Tx:         []Stage{{Name: "skipOdd"}},
+		Sinks:      []Stage{{Name: "batch"}},
+		Batcher:    &BatcherConfig{Blocks: 2, Window: time.Hour},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pl.Close()
+
+	newBlock := func(num uint64) *block.Block {
+		b := &block.Block{Block: &common.Block{Header: &common.BlockHeader{Number: num}}, Num: num}
+		for seq := 0; seq < 2; seq++ {
+			b.Txs = append(b.Txs, &tx.Tx{Seq: seq, Header: &common.ChannelHeader{TxId: fmt.Sprintf("%d-%d", num, seq)}})
+		}
+		return b
+	}
+	for num := uint64(1); num <= 3; num++ {
+		if err := pl.Handle(newBlock(num)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// the checkpoint advances after the batch is written
+	if expected := []uint64{1, 2}; !reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("expected checkpoints %v, got %v", expected, checkpoints)
+	}
+	if err := pl.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := [][]string{{"1-0", "2-0"}, {"3-0"}}; !reflect.DeepEqual(sink.batches, expected) {
+		t.Errorf("expected batches %v, got %v", expected, sink.batches)
+	}
+	if expected := []uint64{1, 2, 3}; !reflect.DeepEqual(checkpoints, expected) {
+		t.Errorf("expected checkpoints %v, got %v", expected, checkpoints)
+	}
+
+	_, err = r.Build(Config{
+		Sinks:       []Stage{{Name: "batch"}},
+		Batcher:     &BatcherConfig{},
+		ErrorPolicy: &ErrorPolicy{DeadLetter: &Stage{Name: "file", Params: Params{"path": filepath.Join(t.TempDir(), "dl.jsonl")}}},
+	}, nil)
+	if err == nil {
+		t.Error("expected error of dead-letter with the batcher")
+	}
+}
+
+func Test_BuildCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "block.num")
+	failing := errors.New("sink failed")
+	r := NewRegistry()
+	r.RegisterSink("failOn2", func(params Params, env *Env) (tx.Handler, error) {
+		return tx.HandlerFunc(func(t *tx.Tx) error {
+			if t.BlockNum == 2 {
+				return failing
+			}
+			return nil
+		}), nil
+	})
+	pl, err := r.Build(Config{
+		Checkpoint: &Stage{Name: "blockNumberFile", Params: Params{"path": path}},
+		Sinks:      []Stage{{Name: "failOn2"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pl.Close()
+
+	if _, ok, err := pl.StartBlock(nil); err != nil || ok {
+		t.Errorf("expected no start block without checkpoint, got %v, %v", ok, err)
+	}
+	for i := uint64(0); i < 3; i++ {
+		err := pl.Handle(blocktest.NewBlock(i).AddEndorserTx("token", "mint").Block().Parse())
+		if i < 2 && err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if i == 2 && !errors.Is(err, failing) {
+			t.Fatalf("expected sink error, got %v", err)
+		}
+	}
+
+	// the checkpoint advances after the block is handled, so the failed block is listened again
+	if bn, ok, err := pl.Checkpoint(); err != nil || !ok || bn != 1 {
+		t.Errorf("expected checkpoint 1, got %d, %v, %v", bn, ok, err)
+	}
+	if bn, ok, err := pl.StartBlock(nil); err != nil || !ok || bn != 2 {
+		t.Errorf("expected start block 2, got %d, %v, %v", bn, ok, err)
+	}
+	start := uint64(10)
+	if bn, ok, err := pl.StartBlock(&start); err != nil || !ok || bn != 10 {
+		t.Errorf("expected start block 10, got %d, %v, %v", bn, ok, err)
+	}
+}
+
+func Test_BuildReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "block.num")
+	handled := []uint64{}
+	r := NewRegistry()
+	r.RegisterSink("collect", func(params Params, env *Env) (tx.Handler, error) {
+		return tx.HandlerFunc(func(t *tx.Tx) error {
+			handled = append(handled, t.BlockNum)
+			return nil
+		}), nil
+	})
+	pl, err := r.Build(Config{
+		Checkpoint: &Stage{Name: "blockNumberFile", Params: Params{"path": path}},
+		Sinks:      []Stage{{Name: "collect"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pl.Close()
+
+	blocks := []*block.Block{}
+	for i := uint64(0); i < 3; i++ {
+		blocks = append(blocks, blocktest.NewBlock(i).AddEndorserTx("token", "mint").Block().Parse())
+		if err := pl.Handle(blocks[i]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// replayed blocks and transactions reach the sinks, but the checkpoint doesn't move back
+	if err := pl.ReplayHandler().Handle(blocks[1]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pl.TxHandler().Handle(blocks[0].Txs[0]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []uint64{0, 1, 2, 1, 0}; !reflect.DeepEqual(handled, expected) {
+		t.Errorf("expected %v, got %v", expected, handled)
+	}
+	if bn, ok, err := pl.Checkpoint(); err != nil || !ok || bn != 2 {
+		t.Errorf("expected checkpoint 2, got %d, %v, %v", bn, ok, err)
+	}
+}
+
+func Test_BuildSQL(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "patrasche.db")
+	cfg := Config{Block: []Stage{{Name: "sql", Params: Params{"driver": "sqlite", "dsn": dsn}}}}
+	pl, err := Build(cfg, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := uint64(0); i < 2; i++ {
+		if err := pl.Handle(blocktest.NewBlock(i).AddEndorserTx("token", "mint").Block().Parse()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := pl.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer db.Close()
+	s, _ := sink.NewSQL(db, sink.SQLite)
+	if n, ok, err := s.Checkpoint(); err != nil || !ok || n != 1 {
+		t.Errorf("expected checkpoint 1, got %d, %v, %v", n, ok, err)
+	}
+
+	// rebuilt, it resumes from the next block of the committed checkpoint
+	pl, err = Build(cfg, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pl.Close()
+	if bn, ok, err := pl.StartBlock(nil); err != nil || !ok || bn != 2 {
+		t.Errorf("expected start block 2, got %d, %v, %v", bn, ok, err)
+	}
+}
+
+func Test_BuildArchive(t *testing.T) {
+	cfg := Config{Block: []Stage{{Name: "archive", Params: Params{"location": t.TempDir()}}}}
+	pl, err := Build(cfg, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handle := func(from, to uint64) {
+		for i := from; i <= to; i++ {
+			if err := pl.Handle(blocktest.NewBlock(i).AddEndorserTx("token", "mint").Block().Parse()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+	if start := pl.Resume(5); start != 5 {
+		t.Errorf("expected 5 without archived blocks, got %d", start)
+	}
+	handle(0, 2)
+	if err := pl.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// blocks 3 and 4 are buffered, the checkpoint may be ahead of them
+	handle(3, 4)
+	if start := pl.Resume(5); start != 3 {
+		t.Errorf("expected 3, got %d", start)
+	}
+	if start, ok, err := pl.StartBlock(nil); err != nil || !ok || start != 3 {
+		t.Errorf("expected start block 3 without start, got %d, %v, %v", start, ok, err)
+	}
+	if start := pl.Resume(2); start != 2 {
+		t.Errorf("expected 2, got %d", start)
+	}
+
+	// buffered blocks are written on close
+	if err := pl.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pl, err = Build(cfg, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer pl.Close()
+	if start := pl.Resume(5); start != 5 {
+		t.Errorf("expected 5, got %d", start)
+	}
+	if start, ok, err := pl.StartBlock(nil); err != nil || !ok || start != 5 {
+		t.Errorf("expected start block 5 without start, got %d, %v, %v", start, ok, err)
+	}
+}
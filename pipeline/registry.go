@@ -0,0 +1,161 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/deadletter"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// Env is the environment shared by factories while building a pipeline
+type Env struct {
+	Logger  *zerolog.Logger
+	Context context.Context // canceled on shutdown, ex) to stop retry backoffs
+
+	closers     []func() error
+	flushers    []func() error
+	checkpoints []func() (uint64, bool, error)
+	resumers    []func(start uint64) uint64
+}
+
+// OnFlush registers the function called by Pipeline.Flush, ex) flushing batches
+func (e *Env) OnFlush(f func() error) {
+	e.flushers = append(e.flushers, f)
+}
+
+// OnCheckpoint registers the function reporting the last block handled by a stage, called by Pipeline.Checkpoint,
+// ok is false if the stage has not handled any block, ex) reading the stored block number
+func (e *Env) OnCheckpoint(f func() (blockNum uint64, ok bool, err error)) {
+	e.checkpoints = append(e.checkpoints, f)
+}
+
+// OnResume registers the function limiting the start block called by Pipeline.Resume,
+// ex) blocks buffered by a handler are lost on a crash even if the checkpoint is ahead of them
+func (e *Env) OnResume(f func(start uint64) uint64) {
+	e.resumers = append(e.resumers, f)
+}
+
+// OnClose registers the function called by Pipeline.Close, ex) closing files
+func (e *Env) OnClose(f func() error) {
+	e.closers = append(e.closers, f)
+}
+
+type BlockFactory func(params Params, env *Env) (block.Middleware, error)
+type TxFactory func(params Params, env *Env) (tx.Middleware, error)
+type SinkFactory func(params Params, env *Env) (tx.Handler, error)
+type DeadLetterFactory func(params Params, env *Env) (deadletter.Sink, error)
+
+// Registry has named handler factories.
+// Names are case-insensitive.
+type Registry struct {
+	mutex       sync.RWMutex
+	blocks      map[string]BlockFactory
+	txs         map[string]TxFactory
+	sinks       map[string]SinkFactory
+	deadLetters map[string]DeadLetterFactory
+}
+
+// NewRegistry returns a registry having built-in factories
+func NewRegistry() *Registry {
+	r := &Registry{
+		blocks:      map[string]BlockFactory{},
+		txs:         map[string]TxFactory{},
+		sinks:       map[string]SinkFactory{},
+		deadLetters: map[string]DeadLetterFactory{},
+	}
+	registerBuiltins(r)
+	return r
+}
+
+func (r *Registry) RegisterBlock(name string, factory BlockFactory) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.blocks[strings.ToLower(name)] = factory
+}
+
+func (r *Registry) RegisterTx(name string, factory TxFactory) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.txs[strings.ToLower(name)] = factory
+}
+
+func (r *Registry) RegisterSink(name string, factory SinkFactory) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sinks[strings.ToLower(name)] = factory
+}
+
+func (r *Registry) RegisterDeadLetter(name string, factory DeadLetterFactory) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.deadLetters[strings.ToLower(name)] = factory
+}
+
+func (r *Registry) block(name string) (BlockFactory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if f, ok := r.blocks[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown block handler: %s", name)
+}
+
+func (r *Registry) tx(name string) (TxFactory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if f, ok := r.txs[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown tx handler: %s", name)
+}
+
+func (r *Registry) sink(name string) (SinkFactory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if f, ok := r.sinks[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown sink: %s", name)
+}
+
+func (r *Registry) deadLetter(name string) (DeadLetterFactory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if f, ok := r.deadLetters[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown dead-letter sink: %s", name)
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry used by Build
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// RegisterBlock registers a block middleware factory to the default registry
+func RegisterBlock(name string, factory BlockFactory) {
+	defaultRegistry.RegisterBlock(name, factory)
+}
+
+// RegisterTx registers a tx middleware factory to the default registry
+func RegisterTx(name string, factory TxFactory) {
+	defaultRegistry.RegisterTx(name, factory)
+}
+
+// RegisterSink registers a sink (final tx handler) factory to the default registry
+func RegisterSink(name string, factory SinkFactory) {
+	defaultRegistry.RegisterSink(name, factory)
+}
+
+// RegisterDeadLetter registers a dead-letter sink factory to the default registry
+func RegisterDeadLetter(name string, factory DeadLetterFactory) {
+	defaultRegistry.RegisterDeadLetter(name, factory)
+}
@@ -0,0 +1,205 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Class is the classification of an error
+type Class int
+
+const (
+	ClassTransient Class = iota // retryable
+	ClassPermanent              // not retryable
+)
+
+// Classifier classifies errors returned by handlers
+type Classifier func(error) Class
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps the error as a permanent error that is not retried by the default classifier
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether any error in err's chain is wrapped by Permanent
+func IsPermanent(err error) bool {
+	var pErr *permanentError
+	return errors.As(err, &pErr)
+}
+
+// DefaultClassifier regards errors wrapped by Permanent as permanent and the others as transient
+func DefaultClassifier(err error) Class {
+	if IsPermanent(err) {
+		return ClassPermanent
+	}
+	return ClassTransient
+}
+
+// Policy is a retry policy with exponential backoff and jitter
+type Policy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64
+	classifier     Classifier
+	onRetry        func(attempt int, err error, wait time.Duration)
+}
+
+type Option func(*Policy) error
+
+// New returns a retry policy.
+// Default is 5 attempts with backoff from 200ms to 30s, multiplier 2 and jitter 0.2.
+func New(options ...Option) (*Policy, error) {
+	p := &Policy{
+		maxAttempts:    5,
+		initialBackoff: 200 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+		multiplier:     2,
+		jitter:         0.2,
+		classifier:     DefaultClassifier,
+	}
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, fmt.Errorf("failed to apply retry option: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// MaxAttempts returns the maximum number of attempts including the first one
+func (p *Policy) MaxAttempts() int {
+	return p.maxAttempts
+}
+
+// Classify classifies the error by the classifier of the policy
+func (p *Policy) Classify(err error) Class {
+	return p.classifier(err)
+}
+
+// Backoff returns the wait duration before the next attempt of the given attempt (1-based)
+func (p *Policy) Backoff(attempt int) time.Duration {
+	d := float64(p.initialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.multiplier
+		if d >= float64(p.maxBackoff) {
+			d = float64(p.maxBackoff)
+			break
+		}
+	}
+	if p.jitter > 0 {
+		d *= 1 + p.jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, returns a permanent error or the attempts are exhausted.
+// It returns the last error of fn, or the context error wrapping it if ctx is done while waiting.
+func (p *Policy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if p.classifier(err) == ClassPermanent {
+			return err
+		}
+		if p.maxAttempts > 0 && attempt >= p.maxAttempts {
+			return err
+		}
+		wait := p.Backoff(attempt)
+		if p.onRetry != nil {
+			p.onRetry(attempt, err, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("retry canceled (%v): %w", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// WithMaxAttempts sets the maximum number of attempts including the first one, 0 is unlimited
+func WithMaxAttempts(n int) Option {
+	return func(p *Policy) error {
+		if n < 0 {
+			return errors.New("negative max attempts")
+		}
+		p.maxAttempts = n
+		return nil
+	}
+}
+
+// WithBackoff sets the initial and maximum backoff durations
+func WithBackoff(initial, max time.Duration) Option {
+	return func(p *Policy) error {
+		if initial <= 0 || max < initial {
+			return fmt.Errorf("invalid backoff range: %s - %s", initial, max)
+		}
+		p.initialBackoff = initial
+		p.maxBackoff = max
+		return nil
+	}
+}
+
+// WithMultiplier sets the backoff multiplier
+func WithMultiplier(multiplier float64) Option {
+	return func(p *Policy) error {
+		if multiplier < 1 {
+			return fmt.Errorf("invalid multiplier: %f", multiplier)
+		}
+		p.multiplier = multiplier
+		return nil
+	}
+}
+
+// WithJitter sets the jitter ratio in [0, 1]
+// The backoff is randomized in [backoff * (1 - jitter), backoff * (1 + jitter)].
+func WithJitter(jitter float64) Option {
+	return func(p *Policy) error {
+		if jitter < 0 || jitter > 1 {
+			return fmt.Errorf("invalid jitter: %f", jitter)
+		}
+		p.jitter = jitter
+		return nil
+	}
+}
+
+// WithClassifier sets the error classifier
+func WithClassifier(classifier Classifier) Option {
+	return func(p *Policy) error {
+		if classifier == nil {
+			return errors.New("classifier is nil")
+		}
+		p.classifier = classifier
+		return nil
+	}
+}
+
+// WithOnRetry sets the function called before waiting for the next attempt
+func WithOnRetry(onRetry func(attempt int, err error, wait time.Duration)) Option {
+	return func(p *Policy) error {
+		p.onRetry = onRetry
+		return nil
+	}
+}
@@ -0,0 +1,82 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_PolicyDo(t *testing.T) {
+	p, err := New(WithMaxAttempts(3), WithBackoff(time.Millisecond, 2*time.Millisecond), WithJitter(0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	calls := 0
+	err = p.Do(context.Background(), func() error {
+		calls++
+		return errors.New("transient")
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("expected 3 attempts and error, got %d, %v", calls, err)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func() error {
+		calls++
+		return Permanent(errors.New("permanent"))
+	})
+	if !IsPermanent(err) || calls != 1 {
+		t.Errorf("expected 1 attempt and permanent error, got %d, %v", calls, err)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected success after 2 attempts, got %d, %v", calls, err)
+	}
+}
+
+func Test_PolicyBackoff(t *testing.T) {
+	p, _ := New(WithBackoff(100*time.Millisecond, time.Second), WithJitter(0))
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, e := range expected {
+		if d := p.Backoff(i + 1); d != e*time.Millisecond {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, e*time.Millisecond, d)
+		}
+	}
+
+	p, _ = New(WithBackoff(100*time.Millisecond, time.Second), WithJitter(0.5))
+	for i := 0; i < 100; i++ {
+		if d := p.Backoff(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %v", d)
+		}
+	}
+}
+
+func Test_PolicyDoCanceled(t *testing.T) {
+	p, _ := New(WithMaxAttempts(0), WithBackoff(time.Hour, time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	transient := errors.New("transient")
+	calls := 0
+	start := time.Now()
+	err := p.Do(ctx, func() error {
+		calls++
+		return transient
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("expected canceled after 1 attempt, got %d, %v", calls, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("backoff is not interrupted: %v", time.Since(start))
+	}
+}
@@ -0,0 +1,187 @@
+// Package schema has the stable representation of blocks, transactions, chaincode events and writes
+// shared by the sinks. Fields are only added, never renamed or removed, within a Version.
+package schema
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/tx"
+)
+
+const Version = 1
+
+type Block struct {
+	Num       uint64     `json:"block_num" dynamodbav:"block_num"`
+	Hash      string     `json:"hash" dynamodbav:"hash"` // hex
+	PrevHash  string     `json:"prev_hash" dynamodbav:"prev_hash"`
+	DataHash  string     `json:"data_hash" dynamodbav:"data_hash"`
+	TxCount   int        `json:"tx_count" dynamodbav:"tx_count"`
+	Timestamp *time.Time `json:"timestamp,omitempty" dynamodbav:"timestamp,omitempty"` // latest tx timestamp
+}
+
+type Tx struct {
+	ID             string    `json:"tx_id" dynamodbav:"tx_id"`
+	BlockNum       uint64    `json:"block_num" dynamodbav:"block_num"`
+	Seq            int       `json:"seq" dynamodbav:"seq"`
+	Channel        string    `json:"channel" dynamodbav:"channel"`
+	Type           string    `json:"type" dynamodbav:"type"`
+	Timestamp      time.Time `json:"timestamp" dynamodbav:"timestamp"`
+	MSPID          string    `json:"mspid" dynamodbav:"mspid"`
+	ValidationCode string    `json:"validation_code" dynamodbav:"validation_code"`
+	Valid          bool      `json:"valid" dynamodbav:"valid"`
+
+	// endorser transaction only
+	Chaincode string   `json:"chaincode,omitempty" dynamodbav:"chaincode,omitempty"`
+	Args      []string `json:"args,omitempty" dynamodbav:"args,omitempty"`
+	Status    int32    `json:"status,omitempty" dynamodbav:"status,omitempty"`
+	Message   string   `json:"message,omitempty" dynamodbav:"message,omitempty"`
+	Event     *Event   `json:"event,omitempty" dynamodbav:"event,omitempty"`
+	Writes    []Write  `json:"writes,omitempty" dynamodbav:"writes,omitempty"`
+}
+
+type Event struct {
+	TxID      string    `json:"tx_id" dynamodbav:"tx_id"`
+	BlockNum  uint64    `json:"block_num" dynamodbav:"block_num"`
+	Seq       int       `json:"seq" dynamodbav:"seq"`
+	Timestamp time.Time `json:"timestamp" dynamodbav:"timestamp"`
+	Chaincode string    `json:"chaincode" dynamodbav:"chaincode"`
+	Name      string    `json:"name" dynamodbav:"name"`
+	Payload   []byte    `json:"payload" dynamodbav:"payload"` // base64 in JSON
+}
+
+type Write struct {
+	Namespace string `json:"namespace" dynamodbav:"namespace"`
+	Key       string `json:"key" dynamodbav:"key"`
+	Value     []byte `json:"value,omitempty" dynamodbav:"value,omitempty"`
+	IsDelete  bool   `json:"is_delete" dynamodbav:"is_delete"`
+}
+
+func NewBlock(b *block.Block) *Block {
+	sb := &Block{
+		Num:     b.Num,
+		Hash:    hex.EncodeToString(b.Hash),
+		TxCount: len(b.Txs),
+	}
+	if b.Block != nil && b.Header != nil {
+		sb.PrevHash = hex.EncodeToString(b.Header.PreviousHash)
+		sb.DataHash = hex.EncodeToString(b.Header.DataHash)
+	}
+	if ts := b.Timestamp(); ts != nil {
+		t := ts.UTC()
+		sb.Timestamp = &t
+	}
+	return sb
+}
+
+// NewTx returns the schema of the transaction.
+// Chaincode fields are filled only for endorser transactions.
+func NewTx(t *tx.Tx) (*Tx, error) {
+	st := &Tx{
+		ID:             t.ID(),
+		BlockNum:       t.BlockNum,
+		Seq:            t.Seq,
+		Channel:        t.Header.ChannelId,
+		Type:           t.HeaderType().String(),
+		Timestamp:      t.Timestamp().UTC(),
+		MSPID:          t.MSPID(),
+		ValidationCode: t.ValidationCode.String(),
+		Valid:          t.IsValid(),
+	}
+	if t.HeaderType() != common.HeaderType_ENDORSER_TRANSACTION {
+		return st, nil
+	}
+
+	spec, err := t.GetChaincodeInvocationSpec()
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil && spec.ChaincodeSpec != nil && spec.ChaincodeSpec.Input != nil {
+		for _, arg := range spec.ChaincodeSpec.Input.Args {
+			st.Args = append(st.Args, string(arg))
+		}
+	}
+
+	ccA, err := t.GetChaincodeAction()
+	if err != nil {
+		return nil, err
+	}
+	if ccA == nil {
+		return st, nil
+	}
+	if ccA.ChaincodeId != nil {
+		st.Chaincode = ccA.ChaincodeId.Name
+	}
+	if ccA.Response != nil {
+		st.Status = ccA.Response.Status
+		st.Message = ccA.Response.Message
+	}
+	if st.Event, err = NewEvent(t); err != nil {
+		return nil, err
+	}
+	if st.Writes, err = NewWrites(t); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// NewEvent returns the chaincode event of the transaction, nil if it has no event
+func NewEvent(t *tx.Tx) (*Event, error) {
+	if t.HeaderType() != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, nil
+	}
+	ccE, err := t.GetChaincodeEvent()
+	if err != nil {
+		return nil, err
+	}
+	if ccE == nil || ccE.EventName == "" {
+		return nil, nil
+	}
+	return &Event{
+		TxID:      t.ID(),
+		BlockNum:  t.BlockNum,
+		Seq:       t.Seq,
+		Timestamp: t.Timestamp().UTC(),
+		Chaincode: ccE.ChaincodeId,
+		Name:      ccE.EventName,
+		Payload:   ccE.Payload,
+	}, nil
+}
+
+// NewWrites returns the public writes of the transaction in the order of the rwset
+func NewWrites(t *tx.Tx) ([]Write, error) {
+	if t.HeaderType() != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, nil
+	}
+	ccA, err := t.GetChaincodeAction()
+	if err != nil || ccA == nil {
+		return nil, err
+	}
+	rws, err := t.GetReadWriteSet()
+	if err != nil || rws == nil {
+		return nil, err
+	}
+	rwm, err := t.GetReadWriteMap()
+	if err != nil {
+		return nil, err
+	}
+	writes := []Write{}
+	for _, nss := range rws.NsRwset {
+		kvs := rwm[nss.Namespace]
+		if kvs == nil {
+			continue
+		}
+		for _, w := range kvs.Writes {
+			writes = append(writes, Write{
+				Namespace: nss.Namespace,
+				Key:       w.Key,
+				Value:     w.Value,
+				IsDelete:  w.IsDelete,
+			})
+		}
+	}
+	return writes, nil
+}
@@ -0,0 +1,315 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/tx"
+)
+
+const (
+	dynamoDBBatchSize    = 25  // maximum number of write requests in a BatchWriteItem call
+	dynamoDBTransactSize = 100 // maximum number of actions in a TransactWriteItems call
+)
+
+// DynamoDBItemFactory maps a transaction to an item, nil item is skipped
+type DynamoDBItemFactory func(*tx.Tx) (any, error)
+
+type dynamoDBItem struct {
+	ID string `dynamodbav:"id"`
+	schema.Tx
+}
+
+// DefaultDynamoDBItem maps a transaction to schema.Tx with the partition key 'id' (tx ID)
+func DefaultDynamoDBItem(t *tx.Tx) (any, error) {
+	st, err := schema.NewTx(t)
+	if err != nil {
+		return nil, err
+	}
+	return dynamoDBItem{ID: st.ID, Tx: *st}, nil
+}
+
+// DynamoDB writes items to a DynamoDB table with a single client.
+// It is a tx handler putting an item per transaction,
+// and also a batch handler (see block.Batcher) writing items with BatchWriteItem.
+type DynamoDB struct {
+	client      *dynamodb.Client
+	table       string
+	key         string
+	itemFactory DynamoDBItemFactory
+	conditional bool
+	policy      *retry.Policy
+	ctx         context.Context
+}
+
+type DynamoDBOption func(*DynamoDB) error
+
+// NewDynamoDB returns a DynamoDB sink, the partition key of the table is 'id' by default
+func NewDynamoDB(cfg aws.Config, table string, options ...DynamoDBOption) (*DynamoDB, error) {
+	if table == "" {
+		return nil, errors.New("table is empty")
+	}
+	policy, err := retry.New()
+	if err != nil {
+		return nil, err
+	}
+	s := &DynamoDB{
+		client:      dynamodb.NewFromConfig(cfg),
+		table:       table,
+		key:         "id",
+		itemFactory: DefaultDynamoDBItem,
+		policy:      policy,
+		ctx:         context.Background(),
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, fmt.Errorf("failed to apply dynamodb option: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *DynamoDB) Handle(t *tx.Tx) error {
+	item, err := s.marshal(t)
+	if err != nil || item == nil {
+		return err
+	}
+	return s.put(item)
+}
+
+// HandleBatch writes items of all transactions in the batch.
+// On conditional mode, items are written by TransactWriteItems because BatchWriteItem doesn't support conditions.
+func (s *DynamoDB) HandleBatch(batch *block.Batch) error {
+	items := []map[string]types.AttributeValue{}
+	for _, t := range batch.Txs() {
+		item, err := s.marshal(t)
+		if err != nil {
+			return err
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	write, size := s.batchWrite, dynamoDBBatchSize
+	if s.conditional {
+		write, size = s.transactPut, dynamoDBTransactSize
+	}
+	for len(items) > 0 {
+		n := len(items)
+		if n > size {
+			n = size
+		}
+		if err := write(items[:n]); err != nil {
+			return err
+		}
+		items = items[n:]
+	}
+	return nil
+}
+
+func (s *DynamoDB) marshal(t *tx.Tx) (map[string]types.AttributeValue, error) {
+	v, err := s.itemFactory(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create item: %w", err)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	item, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal item: %w", err)
+	}
+	if _, ok := item[s.key]; !ok {
+		return nil, retry.Permanent(fmt.Errorf("item has no key attribute: %s", s.key))
+	}
+	return item, nil
+}
+
+// put puts the item, an item already existing is ignored on conditional mode
+func (s *DynamoDB) put(item map[string]types.AttributeValue) error {
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	}
+	if s.conditional {
+		input.ConditionExpression, input.ExpressionAttributeNames = s.condition()
+	}
+	_, err := s.client.PutItem(context.TODO(), input)
+	if err != nil {
+		var ccfErr *types.ConditionalCheckFailedException
+		if errors.As(err, &ccfErr) {
+			return nil
+		}
+		return fmt.Errorf("failed to put item: %w", err)
+	}
+	return nil
+}
+
+// condition returns the expression putting an item only if its key doesn't exist
+func (s *DynamoDB) condition() (*string, map[string]string) {
+	return aws.String("attribute_not_exists(#k)"), map[string]string{"#k": s.key}
+}
+
+// unique drops items having the key of a former item,
+// a request can't have the same key twice, ex) duplicated tx ID of an invalid transaction
+func (s *DynamoDB) unique(items []map[string]types.AttributeValue) []map[string]types.AttributeValue {
+	unique := []map[string]types.AttributeValue{}
+	seen := map[string]bool{}
+	for _, item := range items {
+		id := keyString(item[s.key])
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, item)
+	}
+	return unique
+}
+
+// transactPut puts up to 100 items whose keys don't exist in a TransactWriteItems call.
+// A failed condition cancels the whole transaction, so items already existing are dropped and the rest are put again.
+func (s *DynamoDB) transactPut(items []map[string]types.AttributeValue) error {
+	items = s.unique(items)
+	for len(items) > 0 {
+		actions := []types.TransactWriteItem{}
+		for _, item := range items {
+			put := &types.Put{TableName: aws.String(s.table), Item: item}
+			put.ConditionExpression, put.ExpressionAttributeNames = s.condition()
+			actions = append(actions, types.TransactWriteItem{Put: put})
+		}
+		_, err := s.client.TransactWriteItems(context.TODO(), &dynamodb.TransactWriteItemsInput{TransactItems: actions})
+		if err == nil {
+			return nil
+		}
+		var tcErr *types.TransactionCanceledException
+		if !errors.As(err, &tcErr) {
+			return fmt.Errorf("failed to write items: %w", err)
+		}
+		rest := []map[string]types.AttributeValue{}
+		for i, reason := range tcErr.CancellationReasons {
+			if i < len(items) && aws.ToString(reason.Code) != "ConditionalCheckFailed" {
+				rest = append(rest, items[i])
+			}
+		}
+		if len(rest) == len(items) { // canceled by others, ex) conflicts
+			return fmt.Errorf("failed to write items: %w", err)
+		}
+		items = rest
+	}
+	return nil
+}
+
+// batchWrite writes up to 25 items, unprocessed items are retried with backoff
+func (s *DynamoDB) batchWrite(items []map[string]types.AttributeValue) error {
+	requests := []types.WriteRequest{}
+	for _, item := range s.unique(items) {
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	for attempt := 1; ; attempt++ {
+		out, err := s.client.BatchWriteItem(context.TODO(), &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{s.table: requests},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write items: %w", err)
+		}
+		requests = out.UnprocessedItems[s.table]
+		if len(requests) == 0 {
+			return nil
+		}
+		if max := s.policy.MaxAttempts(); max > 0 && attempt >= max {
+			return fmt.Errorf("failed to write %d unprocessed items", len(requests))
+		}
+		if err := wait(s.ctx, s.policy.Backoff(attempt)); err != nil {
+			return fmt.Errorf("failed to write %d unprocessed items: %w", len(requests), err)
+		}
+	}
+}
+
+// wait waits for the backoff, it returns the context error if ctx is done first
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func keyString(av types.AttributeValue) string {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return "S" + v.Value
+	case *types.AttributeValueMemberN:
+		return "N" + v.Value
+	case *types.AttributeValueMemberB:
+		return "B" + string(v.Value)
+	}
+	return fmt.Sprintf("%T", av)
+}
+
+// WithDynamoDBItem sets the function mapping a transaction to an item
+func WithDynamoDBItem(factory DynamoDBItemFactory) DynamoDBOption {
+	return func(s *DynamoDB) error {
+		if factory == nil {
+			return errors.New("item factory is nil")
+		}
+		s.itemFactory = factory
+		return nil
+	}
+}
+
+// WithDynamoDBKey sets the name of the partition key attribute, default is 'id'
+func WithDynamoDBKey(name string) DynamoDBOption {
+	return func(s *DynamoDB) error {
+		if name == "" {
+			return errors.New("partition key is empty")
+		}
+		s.key = name
+		return nil
+	}
+}
+
+// WithDynamoDBConditional puts items only if the key doesn't exist,
+// so replayed transactions never overwrite items already written
+func WithDynamoDBConditional() DynamoDBOption {
+	return func(s *DynamoDB) error {
+		s.conditional = true
+		return nil
+	}
+}
+
+// WithDynamoDBRetry sets the retry policy for unprocessed items of BatchWriteItem
+func WithDynamoDBRetry(policy *retry.Policy) DynamoDBOption {
+	return func(s *DynamoDB) error {
+		if policy == nil {
+			return errors.New("retry policy is nil")
+		}
+		s.policy = policy
+		return nil
+	}
+}
+
+// WithDynamoDBContext sets the context of retries, canceling it stops waiting for unprocessed items
+func WithDynamoDBContext(ctx context.Context) DynamoDBOption {
+	return func(s *DynamoDB) error {
+		if ctx == nil {
+			return errors.New("context is nil")
+		}
+		s.ctx = ctx
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	patrasche_aws "github.com/key-inside/patrasche/aws"
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/tx"
+)
+
+func newTestDynamoDB(t *testing.T, options ...DynamoDBOption) *DynamoDB {
+	cfg := patrasche_aws.DefaultConfig(patrasche_aws.WithEndpoint("eu-central-1", "http://localhost:8000"))
+	options = append([]DynamoDBOption{WithDynamoDBItem(func(t *tx.Tx) (any, error) {
+		return map[string]any{"id": fmt.Sprintf("sink-%d-%d", t.BlockNum, t.Seq), "block": t.BlockNum}, nil
+	})}, options...)
+	s, err := NewDynamoDB(cfg, ".meta", options...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return s
+}
+
+func Test_DynamoDBHandleBatch(t *testing.T) {
+	s := newTestDynamoDB(t)
+	batch := &block.Batch{}
+	for i := uint64(1); i <= 3; i++ {
+		b := &block.Block{Num: i}
+		for j := 0; j < 10; j++ { // 30 items, 2 BatchWriteItem calls
+			b.Txs = append(b.Txs, &tx.Tx{BlockNum: i, Seq: j})
+		}
+		batch.Blocks = append(batch.Blocks, b)
+	}
+	if err := s.HandleBatch(batch); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func Test_DynamoDBConditional(t *testing.T) {
+	prefix := fmt.Sprintf("sink-cond-%d", time.Now().UnixNano()) // items of former runs remain in the table
+	attempt := 0
+	s := newTestDynamoDB(t, WithDynamoDBConditional(), WithDynamoDBItem(func(t *tx.Tx) (any, error) {
+		return map[string]any{"id": fmt.Sprintf("%s-%d-%d", prefix, t.BlockNum, t.Seq), "attempt": attempt}, nil
+	}))
+
+	// replay of a single item
+	for attempt = 1; attempt <= 2; attempt++ {
+		if err := s.Handle(&tx.Tx{BlockNum: 1, Seq: 0}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// replay of a batch having the item written above and a duplicated tx
+	batch := &block.Batch{Blocks: []*block.Block{
+		{Num: 1, Txs: []*tx.Tx{{BlockNum: 1, Seq: 0}, {BlockNum: 1, Seq: 1}, {BlockNum: 1, Seq: 1}}},
+		{Num: 2, Txs: []*tx.Tx{{BlockNum: 2, Seq: 0}}},
+	}}
+	for attempt = 3; attempt <= 4; attempt++ {
+		if err := s.HandleBatch(batch); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// items are written once by the first attempt, duplicates are skipped
+	expected := map[string]int{"1-0": 1, "1-1": 3, "2-0": 3}
+	for key, first := range expected {
+		out, err := s.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+			TableName: aws.String(s.table),
+			Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: prefix + "-" + key}},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var item struct {
+			Attempt int `dynamodbav:"attempt"`
+		}
+		if out.Item == nil {
+			t.Errorf("%s: item is not written", key)
+			continue
+		}
+		if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if item.Attempt != first {
+			t.Errorf("%s: expected written by attempt %d, got %d", key, first, item.Attempt)
+		}
+	}
+}
+
+func Test_DynamoDBRetryCanceled(t *testing.T) {
+	// every item is unprocessed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		io.WriteString(w, `{"UnprocessedItems":{".meta":[{"PutRequest":{"Item":{"id":{"S":"a"}}}}]}}`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy, _ := retry.New(retry.WithMaxAttempts(0), retry.WithBackoff(time.Hour, time.Hour))
+	s, err := NewDynamoDB(newTestAWSConfig(server.URL), ".meta", WithDynamoDBRetry(policy), WithDynamoDBContext(ctx),
+		WithDynamoDBItem(func(*tx.Tx) (any, error) { return map[string]any{"id": "a"}, nil }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.HandleBatch(&block.Batch{Blocks: []*block.Block{{Num: 1, Txs: []*tx.Tx{{BlockNum: 1}}}}})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected canceled error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry was not canceled")
+	}
+}
@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// limits of a PutRecords call, the size of a record is the data and the partition key
+var kinesisBatchLimit = batchLimit{
+	count: 500,
+	bytes: 5 * 1024 * 1024,
+	entry: 1024 * 1024,
+	size:  func(m message) int { return len(m.body) + len(m.key) },
+}
+
+// Kinesis puts transactions or chaincode events to a data stream with PutRecords.
+// The partition key is the tx ID by default, set WithPublishKey(ChaincodeKey) to keep the order per chaincode.
+type Kinesis struct {
+	*publisher
+	client *kinesis.Client
+	stream string
+}
+
+func NewKinesis(cfg aws.Config, stream string, options ...PublishOption) (*Kinesis, error) {
+	if stream == "" {
+		return nil, errors.New("stream name is empty")
+	}
+	p, err := newPublisher(TxIDKey, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Kinesis{
+		publisher: p,
+		client:    kinesis.NewFromConfig(cfg),
+		stream:    stream,
+	}, nil
+}
+
+func (s *Kinesis) Handle(t *tx.Tx) error {
+	return s.HandleBatch(&block.Batch{Blocks: []*block.Block{{Num: t.BlockNum, Txs: []*tx.Tx{t}}}})
+}
+
+func (s *Kinesis) HandleBatch(batch *block.Batch) error {
+	msgs, err := s.messages(batch.Txs())
+	if err != nil {
+		return err
+	}
+	return s.publish(msgs, kinesisBatchLimit, s.send)
+}
+
+func (s *Kinesis) send(msgs []message) ([]message, error) {
+	records := []types.PutRecordsRequestEntry{}
+	for _, m := range msgs {
+		records = append(records, types.PutRecordsRequestEntry{
+			Data:         m.body,
+			PartitionKey: aws.String(m.key),
+		})
+	}
+
+	out, err := s.client.PutRecords(context.TODO(), &kinesis.PutRecordsInput{
+		StreamName: aws.String(s.stream),
+		Records:    records,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to put records: %w", err)
+	}
+	failed := []message{}
+	if aws.ToInt32(out.FailedRecordCount) > 0 {
+		for i, r := range out.Records { // in the order of the request
+			if r.ErrorCode != nil {
+				failed = append(failed, msgs[i])
+			}
+		}
+	}
+	return failed, nil
+}
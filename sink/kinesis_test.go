@@ -0,0 +1,103 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+type kinesisTestRecord struct {
+	Data         []byte
+	PartitionKey string
+}
+
+func Test_KinesisSend(t *testing.T) {
+	requests := [][]kinesisTestRecord{}
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != "Kinesis_20131202.PutRecords" {
+			t.Errorf("unexpected target: %s", target)
+		}
+		var in struct {
+			StreamName string
+			Records    []kinesisTestRecord
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		requests = append(requests, in.Records)
+		results := []string{}
+		failed := 0
+		for i := range in.Records {
+			if fail && i == 0 && len(in.Records) > 1 { // the first record fails once
+				failed++
+				results = append(results, `{"ErrorCode": "ProvisionedThroughputExceededException", "ErrorMessage": "slow down"}`)
+				continue
+			}
+			results = append(results, fmt.Sprintf(`{"SequenceNumber": "%d", "ShardId": "shardId-000000000000"}`, i))
+		}
+		fail = false
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		fmt.Fprintf(w, `{"FailedRecordCount": %d, "Records": [%s]}`, failed, strings.Join(results, ","))
+	}))
+	defer server.Close()
+
+	b := blocktest.NewBlock(1).
+		AddEndorserTx("token", "mint").
+		AddEndorserTx("token", "transfer").
+		AddEndorserTx("nft", "mint").
+		Block().Parse()
+
+	policy, _ := retry.New(retry.WithBackoff(time.Millisecond, time.Millisecond))
+	s, err := NewKinesis(newTestAWSConfig(server.URL), "txs", WithPublishRetry(policy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.HandleBatch(&block.Batch{Blocks: []*block.Block{b}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(requests) != 2 || len(requests[0]) != 3 || len(requests[1]) != 1 {
+		t.Fatalf("unexpected requests: %d", len(requests))
+	}
+	if r := requests[1][0]; r.PartitionKey != b.Txs[0].ID() { // tx ID by default
+		t.Errorf("unexpected retried record: %s", r.PartitionKey)
+	}
+	var st schema.Tx
+	if err := json.Unmarshal(requests[0][2].Data, &st); err != nil || st.ID != b.Txs[2].ID() {
+		t.Errorf("unexpected data: %s", requests[0][2].Data)
+	}
+
+	// split by the request size, 5 records of 900KiB are within 5MiB
+	requests = requests[:0]
+	body := bytes.Repeat([]byte("x"), 900*1024)
+	s, _ = NewKinesis(newTestAWSConfig(server.URL), "txs", WithPublishBody(func(*schema.Tx) ([]byte, error) { return body, nil }))
+	batch := &block.Batch{}
+	for i := uint64(0); i < 2; i++ {
+		batch.Blocks = append(batch.Blocks, blocktest.NewBlock(i).
+			AddEndorserTx("token", "a").AddEndorserTx("token", "b").AddEndorserTx("token", "c").
+			Block().Parse())
+	}
+	if err := s.HandleBatch(batch); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(requests) != 2 || len(requests[0]) != 5 || len(requests[1]) != 1 {
+		t.Errorf("expected 5 and 1 records, got %d requests", len(requests))
+	}
+
+	// a record over 1MiB can't be put
+	requests = requests[:0]
+	body = bytes.Repeat([]byte("x"), 1024*1024)
+	if err := s.HandleBatch(&block.Batch{Blocks: []*block.Block{b}}); !retry.IsPermanent(err) || len(requests) != 0 {
+		t.Errorf("expected permanent error without requests, got %v, %d", err, len(requests))
+	}
+}
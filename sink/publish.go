@@ -0,0 +1,219 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// message is a transaction or a chaincode event to publish
+type message struct {
+	id    string // tx ID, the deduplication ID
+	key   string // message group ID or partition key
+	body  []byte
+	attrs map[string]string // for filtering, ex) SNS subscription filter policies
+}
+
+// attrsSize returns the size of the message attributes counted by SQS and SNS (name, type and value)
+func (m message) attrsSize() int {
+	size := 0
+	for k, v := range m.attrs {
+		size += len(k) + len("String") + len(v)
+	}
+	return size
+}
+
+// batchLimit has the limits of a batch API call
+type batchLimit struct {
+	count int               // entries in a call
+	bytes int               // total size of entries in a call
+	entry int               // size of an entry
+	size  func(message) int // size of an entry counted by the API
+}
+
+// next returns the number of messages of the next call within the limits
+func (l batchLimit) next(msgs []message) (int, error) {
+	total := 0
+	for i, m := range msgs {
+		size := l.size(m)
+		if size > l.entry {
+			return 0, retry.Permanent(fmt.Errorf("message of tx %s is too large: %d bytes", m.id, size))
+		}
+		if i == l.count || total+size > l.bytes {
+			return i, nil
+		}
+		total += size
+	}
+	return len(msgs), nil
+}
+
+// publisher has the common settings of the message sinks (SQS, SNS and Kinesis)
+type publisher struct {
+	events bool
+	body   func(*schema.Tx) ([]byte, error)
+	key    func(*schema.Tx) string
+	policy *retry.Policy
+	ctx    context.Context
+}
+
+type PublishOption func(*publisher) error
+
+func newPublisher(defaultKey func(*schema.Tx) string, options []PublishOption) (*publisher, error) {
+	policy, err := retry.New()
+	if err != nil {
+		return nil, err
+	}
+	p := &publisher{
+		key:    defaultKey,
+		policy: policy,
+		ctx:    context.Background(),
+	}
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, fmt.Errorf("failed to apply publish option: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// ChaincodeKey returns the chaincode name, or the tx ID for non-chaincode transactions
+func ChaincodeKey(st *schema.Tx) string {
+	if st.Chaincode != "" {
+		return st.Chaincode
+	}
+	return st.ID
+}
+
+// TxIDKey returns the tx ID
+func TxIDKey(st *schema.Tx) string {
+	return st.ID
+}
+
+func (p *publisher) messages(txs []*tx.Tx) ([]message, error) {
+	msgs := []message{}
+	for _, t := range txs {
+		st, err := schema.NewTx(t)
+		if err != nil {
+			return nil, err
+		}
+		if p.events && st.Event == nil {
+			continue
+		}
+
+		var body []byte
+		switch {
+		case p.body != nil:
+			body, err = p.body(st)
+		case p.events:
+			body, err = json.Marshal(st.Event)
+		default:
+			body, err = json.Marshal(st)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message body: %w", err)
+		}
+		if body == nil {
+			continue
+		}
+
+		attrs := map[string]string{"kind": "tx", "valid": strconv.FormatBool(st.Valid)}
+		if st.Chaincode != "" {
+			attrs["chaincode"] = st.Chaincode
+		}
+		if p.events {
+			attrs["kind"] = "event"
+			attrs["eventName"] = st.Event.Name
+		}
+		msgs = append(msgs, message{id: st.ID, key: p.key(st), body: body, attrs: attrs})
+	}
+	return msgs, nil
+}
+
+// publish sends messages in chunks within the limits.
+// The send function returns the failed messages, they are sent again with backoff.
+func (p *publisher) publish(msgs []message, limit batchLimit, send func([]message) ([]message, error)) error {
+	for len(msgs) > 0 {
+		n, err := limit.next(msgs)
+		if err != nil {
+			return err
+		}
+		chunk := msgs[:n]
+		for attempt := 1; ; attempt++ {
+			failed, err := send(chunk)
+			if err != nil {
+				return err
+			}
+			if len(failed) == 0 {
+				break
+			}
+			if max := p.policy.MaxAttempts(); max > 0 && attempt >= max {
+				return fmt.Errorf("failed to publish %d messages", len(failed))
+			}
+			if err := wait(p.ctx, p.policy.Backoff(attempt)); err != nil {
+				return fmt.Errorf("failed to publish %d messages: %w", len(failed), err)
+			}
+			chunk = failed
+		}
+		msgs = msgs[n:]
+	}
+	return nil
+}
+
+// WithPublishEvents publishes chaincode events instead of transactions, transactions without events are skipped
+func WithPublishEvents() PublishOption {
+	return func(p *publisher) error {
+		p.events = true
+		return nil
+	}
+}
+
+// WithPublishBody sets the function creating the message body, nil body is skipped.
+// Default is JSON of schema.Tx, or schema.Event with WithPublishEvents.
+func WithPublishBody(body func(*schema.Tx) ([]byte, error)) PublishOption {
+	return func(p *publisher) error {
+		if body == nil {
+			return errors.New("body function is nil")
+		}
+		p.body = body
+		return nil
+	}
+}
+
+// WithPublishKey sets the function returning the message group ID of SQS/SNS FIFO or the partition key of Kinesis
+func WithPublishKey(key func(*schema.Tx) string) PublishOption {
+	return func(p *publisher) error {
+		if key == nil {
+			return errors.New("key function is nil")
+		}
+		p.key = key
+		return nil
+	}
+}
+
+// WithPublishRetry sets the retry policy for failed entries of batch APIs
+func WithPublishRetry(policy *retry.Policy) PublishOption {
+	return func(p *publisher) error {
+		if policy == nil {
+			return errors.New("retry policy is nil")
+		}
+		p.policy = policy
+		return nil
+	}
+}
+
+// WithPublishContext sets the context of retries, canceling it stops waiting for failed entries
+func WithPublishContext(ctx context.Context) PublishOption {
+	return func(p *publisher) error {
+		if ctx == nil {
+			return errors.New("context is nil")
+		}
+		p.ctx = ctx
+		return nil
+	}
+}
@@ -0,0 +1,181 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/testing/blocktest"
+	"github.com/key-inside/patrasche/tx"
+)
+
+func Test_Publish(t *testing.T) {
+	policy, _ := retry.New(retry.WithBackoff(time.Millisecond, time.Millisecond))
+	p, err := newPublisher(TxIDKey, []PublishOption{WithPublishRetry(policy)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	msgs := []message{}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		msgs = append(msgs, message{id: id})
+	}
+	sent := []string{}
+	calls := 0
+	limit := batchLimit{count: 2, bytes: 1024, entry: 1024, size: func(m message) int { return len(m.body) }}
+	err = p.publish(msgs, limit, func(chunk []message) ([]message, error) {
+		calls++
+		if calls == 1 { // 'b' fails once
+			sent = append(sent, chunk[0].id)
+			return chunk[1:], nil
+		}
+		for _, m := range chunk {
+			sent = append(sent, m.id)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls != 4 || len(sent) != 5 || sent[1] != "b" {
+		t.Errorf("unexpected calls %d, sent %v", calls, sent)
+	}
+}
+
+func Test_PublishCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy, _ := retry.New(retry.WithMaxAttempts(0), retry.WithBackoff(time.Hour, time.Hour))
+	p, err := newPublisher(TxIDKey, []PublishOption{WithPublishRetry(policy), WithPublishContext(ctx)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	limit := batchLimit{count: 2, bytes: 1024, entry: 1024, size: func(m message) int { return len(m.body) }}
+	done := make(chan error, 1)
+	go func() {
+		done <- p.publish([]message{{id: "a"}}, limit, func(chunk []message) ([]message, error) {
+			return chunk, nil // always fails
+		})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected canceled error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry was not canceled")
+	}
+}
+
+func Test_BatchLimit(t *testing.T) {
+	limit := batchLimit{count: 3, bytes: 10, entry: 6, size: func(m message) int { return len(m.body) }}
+	msgs := func(sizes ...int) []message {
+		ms := []message{}
+		for _, size := range sizes {
+			ms = append(ms, message{id: "tx", body: make([]byte, size)})
+		}
+		return ms
+	}
+
+	tests := []struct {
+		sizes []int
+		n     int
+	}{
+		{sizes: []int{1, 1, 1, 1}, n: 3},    // by count
+		{sizes: []int{4, 4, 4}, n: 2},       // by bytes
+		{sizes: []int{5, 6}, n: 1},          // by bytes
+		{sizes: []int{4, 6}, n: 2},          // bytes limit is inclusive
+		{sizes: []int{2}, n: 1},             // all
+		{sizes: []int{6, 1, 1, 1, 1}, n: 3}, // the largest entry
+	}
+	for _, tt := range tests {
+		n, err := limit.next(msgs(tt.sizes...))
+		if err != nil || n != tt.n {
+			t.Errorf("%v: expected %d, got %d, %v", tt.sizes, tt.n, n, err)
+		}
+	}
+
+	if _, err := limit.next(msgs(1, 7)); !retry.IsPermanent(err) {
+		t.Errorf("expected permanent error of too large message, got %v", err)
+	}
+}
+
+func Test_PublishMessages(t *testing.T) {
+	b := blocktest.NewBlock(1).
+		AddEndorserTx("token", "mint", "alice", "10").Event("minted", []byte("alice")).
+		AddEndorserTx("token", "transfer", "alice", "bob", "1").Invalid(peer.TxValidationCode_MVCC_READ_CONFLICT).
+		AddEndorserTx("nft", "burn", "1").Event("burned", nil).
+		Block().Parse()
+	ids := []string{b.Txs[0].ID(), b.Txs[1].ID(), b.Txs[2].ID()}
+
+	// transactions
+	p, _ := newPublisher(ChaincodeKey, nil)
+	msgs, err := p.messages(b.Txs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(msgs))
+	}
+	if m := msgs[1]; m.id != ids[1] || m.key != "token" || !strings.Contains(string(m.body), ids[1]) {
+		t.Errorf("unexpected message: %s %s %s", m.id, m.key, m.body)
+	}
+	expected := []map[string]string{
+		{"kind": "tx", "valid": "true", "chaincode": "token"},
+		{"kind": "tx", "valid": "false", "chaincode": "token"},
+		{"kind": "tx", "valid": "true", "chaincode": "nft"},
+	}
+	for i, m := range msgs {
+		if !reflect.DeepEqual(m.attrs, expected[i]) {
+			t.Errorf("#%d: expected attributes %v, got %v", i, expected[i], m.attrs)
+		}
+	}
+
+	// chaincode events, transactions without events are skipped
+	p, _ = newPublisher(TxIDKey, []PublishOption{WithPublishEvents()})
+	msgs, err = p.messages(b.Txs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].id != ids[0] || msgs[1].id != ids[2] || msgs[1].key != ids[2] {
+		t.Fatalf("unexpected event messages: %+v", msgs)
+	}
+	if attrs := msgs[0].attrs; attrs["kind"] != "event" || attrs["eventName"] != "minted" || attrs["chaincode"] != "token" {
+		t.Errorf("unexpected event attributes: %v", attrs)
+	}
+	if !strings.Contains(string(msgs[0].body), `"minted"`) {
+		t.Errorf("unexpected event body: %s", msgs[0].body)
+	}
+
+	// custom body and key, nil body is skipped
+	p, _ = newPublisher(TxIDKey, []PublishOption{
+		WithPublishBody(func(st *schema.Tx) ([]byte, error) {
+			if !st.Valid {
+				return nil, nil
+			}
+			return []byte(st.Chaincode), nil
+		}),
+		WithPublishKey(func(st *schema.Tx) string { return "key" }),
+	})
+	msgs, err = p.messages(b.Txs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(msgs) != 2 || string(msgs[0].body) != "token" || string(msgs[1].body) != "nft" || msgs[0].key != "key" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+
+	failing := errors.New("body failed")
+	p, _ = newPublisher(TxIDKey, []PublishOption{WithPublishBody(func(*schema.Tx) ([]byte, error) { return nil, failing })})
+	if _, err := p.messages([]*tx.Tx{b.Txs[0]}); !errors.Is(err, failing) {
+		t.Errorf("expected body error, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// limits of a PublishBatch call, the size is the sum of messages and attributes
+var snsBatchLimit = batchLimit{
+	count: 10,
+	bytes: 256 * 1024,
+	entry: 256 * 1024,
+	size:  func(m message) int { return len(m.body) + m.attrsSize() },
+}
+
+// SNS publishes transactions or chaincode events to a topic with PublishBatch.
+// Messages have 'kind', 'valid', 'chaincode' and 'eventName' attributes for subscription filter policies.
+type SNS struct {
+	*publisher
+	client   *sns.Client
+	topicARN string
+	fifo     bool
+}
+
+func NewSNS(cfg aws.Config, topicARN string, options ...PublishOption) (*SNS, error) {
+	if topicARN == "" {
+		return nil, errors.New("topic ARN is empty")
+	}
+	p, err := newPublisher(ChaincodeKey, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SNS{
+		publisher: p,
+		client:    sns.NewFromConfig(cfg),
+		topicARN:  topicARN,
+		fifo:      strings.HasSuffix(topicARN, ".fifo"),
+	}, nil
+}
+
+func (s *SNS) Handle(t *tx.Tx) error {
+	return s.HandleBatch(&block.Batch{Blocks: []*block.Block{{Num: t.BlockNum, Txs: []*tx.Tx{t}}}})
+}
+
+func (s *SNS) HandleBatch(batch *block.Batch) error {
+	msgs, err := s.messages(batch.Txs())
+	if err != nil {
+		return err
+	}
+	return s.publish(msgs, snsBatchLimit, s.send)
+}
+
+func (s *SNS) send(msgs []message) ([]message, error) {
+	entries := []types.PublishBatchRequestEntry{}
+	for i, m := range msgs {
+		entry := types.PublishBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			Message:           aws.String(string(m.body)),
+			MessageAttributes: map[string]types.MessageAttributeValue{},
+		}
+		for k, v := range m.attrs {
+			entry.MessageAttributes[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+		if s.fifo {
+			entry.MessageGroupId = aws.String(m.key)
+			entry.MessageDeduplicationId = aws.String(m.id)
+		}
+		entries = append(entries, entry)
+	}
+
+	out, err := s.client.PublishBatch(context.TODO(), &sns.PublishBatchInput{
+		TopicArn:                   aws.String(s.topicARN),
+		PublishBatchRequestEntries: entries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish messages: %w", err)
+	}
+	failed := []message{}
+	for _, f := range out.Failed {
+		if f.SenderFault {
+			return nil, retry.Permanent(fmt.Errorf("failed to publish message: %s %s", aws.ToString(f.Code), aws.ToString(f.Message)))
+		}
+		i, _ := strconv.Atoi(aws.ToString(f.Id))
+		failed = append(failed, msgs[i])
+	}
+	return failed, nil
+}
@@ -0,0 +1,328 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/schema"
+)
+
+// Dialect has the differences of SQL databases
+type Dialect struct {
+	Name   string
+	BigInt string
+	Bytes  string
+	Time   string
+	Bool   string
+
+	numbered bool // $1, $2, ... instead of ?
+}
+
+var (
+	Postgres = &Dialect{Name: "postgres", BigInt: "BIGINT", Bytes: "BYTEA", Time: "TIMESTAMPTZ", Bool: "BOOLEAN", numbered: true}
+	SQLite   = &Dialect{Name: "sqlite", BigInt: "INTEGER", Bytes: "BLOB", Time: "TIMESTAMP", Bool: "BOOLEAN"}
+)
+
+// DialectByName returns the dialect, ex) postgres, pgx, sqlite, sqlite3
+func DialectByName(name string) (*Dialect, error) {
+	switch strings.ToLower(name) {
+	case "postgres", "postgresql", "pgx":
+		return Postgres, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	}
+	return nil, fmt.Errorf("unknown SQL dialect: %s", name)
+}
+
+// rebind converts ? placeholders to the dialect
+func (d *Dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// migrations returns the DDL statements of each schema version, never modify released versions
+func (d *Dialect) migrations(prefix string) [][]string {
+	return [][]string{
+		// version 1
+		{
+			fmt.Sprintf(`CREATE TABLE %sblocks (
+				block_num %s PRIMARY KEY,
+				hash VARCHAR(64) NOT NULL,
+				prev_hash VARCHAR(64) NOT NULL,
+				data_hash VARCHAR(64) NOT NULL,
+				tx_count INTEGER NOT NULL,
+				timestamp %s NULL
+			)`, prefix, d.BigInt, d.Time),
+			fmt.Sprintf(`CREATE TABLE %stransactions (
+				block_num %s NOT NULL,
+				seq INTEGER NOT NULL,
+				tx_id VARCHAR(64) NOT NULL,
+				channel VARCHAR(255) NOT NULL,
+				type VARCHAR(64) NOT NULL,
+				timestamp %s NOT NULL,
+				mspid VARCHAR(255) NOT NULL,
+				validation_code VARCHAR(64) NOT NULL,
+				valid %s NOT NULL,
+				chaincode VARCHAR(255) NOT NULL,
+				args TEXT NOT NULL,
+				status INTEGER NOT NULL,
+				message TEXT NOT NULL,
+				PRIMARY KEY (block_num, seq)
+			)`, prefix, d.BigInt, d.Time, d.Bool),
+			fmt.Sprintf(`CREATE INDEX %stransactions_tx_id ON %stransactions (tx_id)`, prefix, prefix),
+			fmt.Sprintf(`CREATE TABLE %sevents (
+				block_num %s NOT NULL,
+				seq INTEGER NOT NULL,
+				tx_id VARCHAR(64) NOT NULL,
+				chaincode VARCHAR(255) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				payload %s NULL,
+				PRIMARY KEY (block_num, seq)
+			)`, prefix, d.BigInt, d.Bytes),
+			fmt.Sprintf(`CREATE INDEX %sevents_name ON %sevents (chaincode, name)`, prefix, prefix),
+			fmt.Sprintf(`CREATE TABLE %swrites (
+				block_num %s NOT NULL,
+				seq INTEGER NOT NULL,
+				idx INTEGER NOT NULL,
+				namespace VARCHAR(255) NOT NULL,
+				key TEXT NOT NULL,
+				value %s NULL,
+				is_delete %s NOT NULL,
+				PRIMARY KEY (block_num, seq, idx)
+			)`, prefix, d.BigInt, d.Bytes, d.Bool),
+			fmt.Sprintf(`CREATE TABLE %scheckpoints (
+				name VARCHAR(255) PRIMARY KEY,
+				block_num %s NOT NULL,
+				updated_at %s NOT NULL
+			)`, prefix, d.BigInt, d.Time),
+		},
+	}
+}
+
+// SQL writes blocks, transactions, chaincode events and writes into a normalized schema.
+// Each block (or batch) is written in a DB transaction together with the checkpoint,
+// and blocks at or below the checkpoint are skipped, so every block is processed exactly once.
+// Drivers are not imported, import one for the dialect. ex) github.com/lib/pq
+type SQL struct {
+	db      *sql.DB
+	dialect *Dialect
+	prefix  string
+	name    string // checkpoint name
+}
+
+type SQLOption func(*SQL) error
+
+// NewSQL returns a SQL sink, it doesn't migrate the schema, call Migrate before handling blocks
+func NewSQL(db *sql.DB, dialect *Dialect, options ...SQLOption) (*SQL, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	if dialect == nil {
+		return nil, errors.New("dialect is nil")
+	}
+	s := &SQL{
+		db:      db,
+		dialect: dialect,
+		prefix:  "patrasche_",
+		name:    "default",
+	}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, fmt.Errorf("failed to apply sql option: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Migrate applies the schema migrations not applied yet
+func (s *SQL) Migrate() error {
+	ctx := context.TODO()
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %sschema_migrations (version INTEGER PRIMARY KEY, applied_at %s NOT NULL)`,
+		s.prefix, s.dialect.Time))
+	if err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+
+	var version int
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) FROM %sschema_migrations`, s.prefix))
+	if err := row.Scan(&version); err != nil {
+		return fmt.Errorf("failed to query schema version: %w", err)
+	}
+
+	migrations := s.dialect.migrations(s.prefix)
+	for v := version + 1; v <= len(migrations); v++ {
+		err := s.inTx(func(tx *sql.Tx) error {
+			for _, stmt := range migrations[v-1] {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, s.dialect.rebind(fmt.Sprintf(
+				`INSERT INTO %sschema_migrations (version, applied_at) VALUES (?, ?)`, s.prefix)), v, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint returns the last committed block number, ok is false if there is no checkpoint
+func (s *SQL) Checkpoint() (blockNum uint64, ok bool, err error) {
+	err = s.db.QueryRowContext(context.TODO(), s.dialect.rebind(fmt.Sprintf(
+		`SELECT block_num FROM %scheckpoints WHERE name = ?`, s.prefix)), s.name).Scan(&blockNum)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to query checkpoint: %w", err)
+	}
+	return blockNum, true, nil
+}
+
+func (s *SQL) Handle(b *block.Block) error {
+	return s.HandleBatch(&block.Batch{Blocks: []*block.Block{b}})
+}
+
+// HandleBatch writes all blocks of the batch and the checkpoint in a DB transaction
+func (s *SQL) HandleBatch(batch *block.Batch) error {
+	if len(batch.Blocks) == 0 {
+		return nil
+	}
+	return s.inTx(func(tx *sql.Tx) error {
+		var checkpoint uint64
+		err := tx.QueryRowContext(context.TODO(), s.dialect.rebind(fmt.Sprintf(
+			`SELECT block_num FROM %scheckpoints WHERE name = ?`, s.prefix)), s.name).Scan(&checkpoint)
+		hasCheckpoint := err == nil
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to query checkpoint: %w", err)
+		}
+
+		written := false
+		for _, b := range batch.Blocks {
+			if hasCheckpoint && b.Num <= checkpoint {
+				continue // already committed
+			}
+			if err := s.writeBlock(tx, b); err != nil {
+				return fmt.Errorf("failed to write block %d: %w", b.Num, err)
+			}
+			written = true
+		}
+		if !written {
+			return nil
+		}
+
+		_, err = tx.ExecContext(context.TODO(), s.dialect.rebind(fmt.Sprintf(
+			`INSERT INTO %scheckpoints (name, block_num, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET block_num = excluded.block_num, updated_at = excluded.updated_at`, s.prefix)),
+			s.name, batch.Last().Num, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to update checkpoint: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQL) writeBlock(tx *sql.Tx, b *block.Block) error {
+	ctx := context.TODO()
+	sb := schema.NewBlock(b)
+	_, err := tx.ExecContext(ctx, s.dialect.rebind(fmt.Sprintf(
+		`INSERT INTO %sblocks (block_num, hash, prev_hash, data_hash, tx_count, timestamp) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`, s.prefix)),
+		sb.Num, sb.Hash, sb.PrevHash, sb.DataHash, sb.TxCount, sb.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range b.Txs {
+		st, err := schema.NewTx(t)
+		if err != nil {
+			return err
+		}
+		args, err := json.Marshal(st.Args)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.dialect.rebind(fmt.Sprintf(
+			`INSERT INTO %stransactions (block_num, seq, tx_id, channel, type, timestamp, mspid, validation_code, valid, chaincode, args, status, message)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`, s.prefix)),
+			st.BlockNum, st.Seq, st.ID, st.Channel, st.Type, st.Timestamp, st.MSPID, st.ValidationCode, st.Valid,
+			st.Chaincode, string(args), st.Status, st.Message)
+		if err != nil {
+			return err
+		}
+
+		if e := st.Event; e != nil {
+			_, err = tx.ExecContext(ctx, s.dialect.rebind(fmt.Sprintf(
+				`INSERT INTO %sevents (block_num, seq, tx_id, chaincode, name, payload) VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT DO NOTHING`, s.prefix)),
+				e.BlockNum, e.Seq, e.TxID, e.Chaincode, e.Name, e.Payload)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, w := range st.Writes {
+			_, err = tx.ExecContext(ctx, s.dialect.rebind(fmt.Sprintf(
+				`INSERT INTO %swrites (block_num, seq, idx, namespace, key, value, is_delete) VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT DO NOTHING`, s.prefix)),
+				st.BlockNum, st.Seq, i, w.Namespace, w.Key, w.Value, w.IsDelete)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SQL) inTx(fn func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// WithSQLTablePrefix sets the prefix of the table names, default is 'patrasche_'
+func WithSQLTablePrefix(prefix string) SQLOption {
+	return func(s *SQL) error {
+		s.prefix = prefix
+		return nil
+	}
+}
+
+// WithSQLCheckpointName sets the checkpoint name, listeners sharing a database must have different names
+func WithSQLCheckpointName(name string) SQLOption {
+	return func(s *SQL) error {
+		if name == "" {
+			return errors.New("checkpoint name is empty")
+		}
+		s.name = name
+		return nil
+	}
+}
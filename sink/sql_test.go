@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+func Test_DialectRebind(t *testing.T) {
+	query := "INSERT INTO t (a, b) VALUES (?, ?)"
+	if q := SQLite.rebind(query); q != query {
+		t.Errorf("expected %s, got %s", query, q)
+	}
+	if q, expected := Postgres.rebind(query), "INSERT INTO t (a, b) VALUES ($1, $2)"; q != expected {
+		t.Errorf("expected %s, got %s", expected, q)
+	}
+}
+
+func Test_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patrasche.db")
+	open := func() (*sql.DB, *SQL) {
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		s, err := NewSQL(db, SQLite)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := s.Migrate(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return db, s
+	}
+	count := func(db *sql.DB, table string) int {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM patrasche_" + table).Scan(&n); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return n
+	}
+
+	db, s := open()
+	if _, ok, err := s.Checkpoint(); err != nil || ok {
+		t.Fatalf("expected no checkpoint, got %v, %v", ok, err)
+	}
+	if err := s.Migrate(); err != nil { // migrated already
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	blocks := []*block.Block{}
+	for i := uint64(0); i < 3; i++ {
+		blocks = append(blocks, blocktest.NewBlock(i).
+			AddEndorserTx("token", "mint", "alice", "10").
+			Write("token", "alice", []byte("10")).
+			Event("minted", []byte("alice")).
+			AddEndorserTx("token", "burn", "alice", "1").
+			Delete("token", "alice").
+			Block().Parse())
+	}
+
+	if err := s.HandleBatch(&block.Batch{Blocks: blocks[:2]}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n, ok, err := s.Checkpoint(); err != nil || !ok || n != 1 {
+		t.Fatalf("expected checkpoint 1, got %d, %v, %v", n, ok, err)
+	}
+
+	// replaying the same blocks writes nothing twice
+	if err := s.HandleBatch(&block.Batch{Blocks: blocks}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.Handle(blocks[1]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// rows already written by another checkpoint are not duplicated
+	other, err := NewSQL(db, SQLite, WithSQLCheckpointName("other"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := other.HandleBatch(&block.Batch{Blocks: blocks}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]int{"blocks": 3, "transactions": 6, "events": 3, "writes": 6, "checkpoints": 2}
+	for table, n := range expected {
+		if c := count(db, table); c != n {
+			t.Errorf("%s: expected %d rows, got %d", table, n, c)
+		}
+	}
+	db.Close()
+
+	// resumes from the checkpoint
+	db, s = open()
+	defer db.Close()
+	if n, ok, err := s.Checkpoint(); err != nil || !ok || n != 2 {
+		t.Fatalf("expected checkpoint 2, got %d, %v, %v", n, ok, err)
+	}
+	var txID string
+	if err := db.QueryRow("SELECT tx_id FROM patrasche_transactions WHERE block_num = 2 AND seq = 1").Scan(&txID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if txID != blocks[2].Txs[1].ID() {
+		t.Errorf("expected tx %s, got %s", blocks[2].Txs[1].ID(), txID)
+	}
+}
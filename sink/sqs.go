@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// limits of a SendMessageBatch call, the size is the sum of bodies and attributes
+var sqsBatchLimit = batchLimit{
+	count: 10,
+	bytes: 256 * 1024,
+	entry: 256 * 1024,
+	size:  func(m message) int { return len(m.body) + m.attrsSize() },
+}
+
+// SQS sends transactions or chaincode events to a queue with SendMessageBatch.
+// On FIFO queues (.fifo), the message group ID is the chaincode name by default and the deduplication ID is the tx ID.
+type SQS struct {
+	*publisher
+	client   *sqs.Client
+	queueURL string
+	fifo     bool
+}
+
+func NewSQS(cfg aws.Config, queueURL string, options ...PublishOption) (*SQS, error) {
+	if queueURL == "" {
+		return nil, errors.New("queue URL is empty")
+	}
+	p, err := newPublisher(ChaincodeKey, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SQS{
+		publisher: p,
+		client:    sqs.NewFromConfig(cfg),
+		queueURL:  queueURL,
+		fifo:      strings.HasSuffix(queueURL, ".fifo"),
+	}, nil
+}
+
+func (s *SQS) Handle(t *tx.Tx) error {
+	return s.HandleBatch(&block.Batch{Blocks: []*block.Block{{Num: t.BlockNum, Txs: []*tx.Tx{t}}}})
+}
+
+func (s *SQS) HandleBatch(batch *block.Batch) error {
+	msgs, err := s.messages(batch.Txs())
+	if err != nil {
+		return err
+	}
+	return s.publish(msgs, sqsBatchLimit, s.send)
+}
+
+func (s *SQS) send(msgs []message) ([]message, error) {
+	entries := []types.SendMessageBatchRequestEntry{}
+	for i, m := range msgs {
+		entry := types.SendMessageBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			MessageBody:       aws.String(string(m.body)),
+			MessageAttributes: map[string]types.MessageAttributeValue{},
+		}
+		for k, v := range m.attrs {
+			entry.MessageAttributes[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+		if s.fifo {
+			entry.MessageGroupId = aws.String(m.key)
+			entry.MessageDeduplicationId = aws.String(m.id)
+		}
+		entries = append(entries, entry)
+	}
+
+	out, err := s.client.SendMessageBatch(context.TODO(), &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(s.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send messages: %w", err)
+	}
+	failed := []message{}
+	for _, f := range out.Failed {
+		if f.SenderFault {
+			return nil, retry.Permanent(fmt.Errorf("failed to send message: %s %s", aws.ToString(f.Code), aws.ToString(f.Message)))
+		}
+		i, _ := strconv.Atoi(aws.ToString(f.Id))
+		failed = append(failed, msgs[i])
+	}
+	return failed, nil
+}
@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+// newTestAWSConfig returns the config of a fake AWS endpoint
+func newTestAWSConfig(url string) aws.Config {
+	return aws.Config{
+		Region:       "eu-central-1",
+		Credentials:  aws.AnonymousCredentials{},
+		BaseEndpoint: aws.String(url),
+	}
+}
+
+type sqsTestEntry struct {
+	Id                     string
+	MessageBody            string
+	MessageGroupId         string
+	MessageDeduplicationId string
+	MessageAttributes      map[string]struct{ DataType, StringValue string }
+}
+
+func Test_SQSSend(t *testing.T) {
+	requests := [][]sqsTestEntry{}
+	failure := `{"Id": "1", "SenderFault": false, "Code": "InternalError"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != "AmazonSQS.SendMessageBatch" {
+			t.Errorf("unexpected target: %s", target)
+		}
+		var in struct {
+			QueueUrl string
+			Entries  []sqsTestEntry
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		requests = append(requests, in.Entries)
+		succeeded := []string{}
+		for _, e := range in.Entries {
+			if e.Id != "1" || failure == "" {
+				succeeded = append(succeeded, fmt.Sprintf(`{"Id": %q, "MessageId": "m%s"}`, e.Id, e.Id))
+			}
+		}
+		failed := failure
+		if len(in.Entries) < 2 {
+			failed = ""
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		fmt.Fprintf(w, `{"Successful": [%s], "Failed": [%s]}`, strings.Join(succeeded, ","), failed)
+	}))
+	defer server.Close()
+
+	policy, _ := retry.New(retry.WithBackoff(time.Millisecond, time.Millisecond))
+	s, err := NewSQS(newTestAWSConfig(server.URL), server.URL+"/000000000000/txs.fifo", WithPublishRetry(policy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b := blocktest.NewBlock(1).
+		AddEndorserTx("token", "mint").
+		AddEndorserTx("token", "transfer").
+		AddEndorserTx("nft", "mint").
+		Block().Parse()
+	if err := s.HandleBatch(&block.Batch{Blocks: []*block.Block{b}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the failed entry is sent again
+	if len(requests) != 2 || len(requests[0]) != 3 || len(requests[1]) != 1 {
+		t.Fatalf("unexpected requests: %+v", requests)
+	}
+	retried := requests[1][0]
+	if retried.MessageDeduplicationId != b.Txs[1].ID() || retried.MessageGroupId != "token" {
+		t.Errorf("unexpected retried entry: %+v", retried)
+	}
+	e := requests[0][2]
+	var st schema.Tx
+	if err := json.Unmarshal([]byte(e.MessageBody), &st); err != nil || st.ID != b.Txs[2].ID() {
+		t.Errorf("unexpected body: %s", e.MessageBody)
+	}
+	if e.MessageGroupId != "nft" || e.MessageDeduplicationId != st.ID {
+		t.Errorf("unexpected FIFO IDs: %s, %s", e.MessageGroupId, e.MessageDeduplicationId)
+	}
+	for k, v := range map[string]string{"kind": "tx", "valid": "true", "chaincode": "nft"} {
+		if a := e.MessageAttributes[k]; a.DataType != "String" || a.StringValue != v {
+			t.Errorf("attribute %s: expected %s, got %+v", k, v, a)
+		}
+	}
+
+	// split by the total size
+	requests = requests[:0]
+	failure = ""
+	s, _ = NewSQS(newTestAWSConfig(server.URL), server.URL+"/000000000000/txs", WithPublishBody(func(*schema.Tx) ([]byte, error) {
+		return []byte(strings.Repeat("x", 100*1024)), nil
+	}))
+	if err := s.HandleBatch(&block.Batch{Blocks: []*block.Block{b}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(requests) != 2 || len(requests[0]) != 2 || len(requests[1]) != 1 {
+		t.Errorf("expected 2 and 1 entries, got %d requests", len(requests))
+	}
+	if requests[0][0].MessageGroupId != "" {
+		t.Errorf("standard queue must not have message group ID: %+v", requests[0][0])
+	}
+
+	// sender faults are not retried
+	failure = `{"Id": "1", "SenderFault": true, "Code": "InvalidParameterValue"}`
+	s, _ = NewSQS(newTestAWSConfig(server.URL), server.URL+"/000000000000/txs", WithPublishRetry(policy))
+	if err := s.HandleBatch(&block.Batch{Blocks: []*block.Block{b}}); !retry.IsPermanent(err) {
+		t.Errorf("expected permanent error, got %v", err)
+	}
+}
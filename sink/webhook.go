@@ -0,0 +1,275 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/tx"
+)
+
+const (
+	SignatureHeader = "X-Patrasche-Signature" // sha256=<hex of HMAC-SHA256(secret, body)>
+	DeliveryHeader  = "X-Patrasche-Delivery"  // tx ID
+	KindHeader      = "X-Patrasche-Kind"      // tx or event
+)
+
+// WebhookRoute is a destination of the webhook.
+// A route posts schema.Tx, or schema.Event if Events is set (transactions without events are skipped).
+// All filters must match to post.
+type WebhookRoute struct {
+	URL       string
+	Events    bool
+	Chaincode string         // exact chaincode name, empty is all
+	EventName *regexp.Regexp // event name pattern, nil is all
+	Filter    func(*schema.Tx) bool
+	Headers   map[string]string
+}
+
+func (r *WebhookRoute) match(st *schema.Tx) bool {
+	if r.Events && st.Event == nil {
+		return false
+	}
+	if r.Chaincode != "" && r.Chaincode != st.Chaincode {
+		return false
+	}
+	if r.EventName != nil && (st.Event == nil || !r.EventName.MatchString(st.Event.Name)) {
+		return false
+	}
+	if r.Filter != nil && !r.Filter(st) {
+		return false
+	}
+	return true
+}
+
+// Webhook posts transactions or chaincode events as JSON to the routes.
+// Posts of a transaction (or a batch, see block.Batcher) run concurrently up to the limit,
+// and the handler returns after all of them succeed or fail.
+type Webhook struct {
+	ctx     context.Context
+	routes  []WebhookRoute
+	client  *http.Client
+	secret  []byte
+	policy  *retry.Policy
+	limit   int
+	timeout time.Duration
+}
+
+type WebhookOption func(*Webhook) error
+
+// NewWebhook returns a webhook sink, default timeout is 10s, concurrency limit is 4 and retry policy is retry.New()
+func NewWebhook(routes []WebhookRoute, options ...WebhookOption) (*Webhook, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("no webhook route")
+	}
+	for _, r := range routes {
+		if r.URL == "" {
+			return nil, errors.New("webhook URL is empty")
+		}
+	}
+	policy, err := retry.New()
+	if err != nil {
+		return nil, err
+	}
+	w := &Webhook{
+		ctx:     context.Background(),
+		routes:  routes,
+		client:  &http.Client{},
+		policy:  policy,
+		limit:   4,
+		timeout: 10 * time.Second,
+	}
+	for _, option := range options {
+		if err := option(w); err != nil {
+			return nil, fmt.Errorf("failed to apply webhook option: %w", err)
+		}
+	}
+	return w, nil
+}
+
+type delivery struct {
+	route *WebhookRoute
+	id    string
+	kind  string
+	body  []byte
+}
+
+func (w *Webhook) Handle(t *tx.Tx) error {
+	return w.HandleBatch(&block.Batch{Blocks: []*block.Block{{Num: t.BlockNum, Txs: []*tx.Tx{t}}}})
+}
+
+func (w *Webhook) HandleBatch(batch *block.Batch) error {
+	deliveries := []delivery{}
+	for _, t := range batch.Txs() {
+		st, err := schema.NewTx(t)
+		if err != nil {
+			return err
+		}
+		for i := range w.routes {
+			r := &w.routes[i]
+			if !r.match(st) {
+				continue
+			}
+			d := delivery{route: r, id: st.ID, kind: "tx"}
+			if r.Events {
+				d.kind = "event"
+				d.body, err = json.Marshal(st.Event)
+			} else {
+				d.body, err = json.Marshal(st)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s: %w", d.kind, err)
+			}
+			deliveries = append(deliveries, d)
+		}
+	}
+	return w.deliver(deliveries)
+}
+
+func (w *Webhook) deliver(deliveries []delivery) error {
+	sem := make(chan struct{}, w.limit)
+	errs := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d := &deliveries[i]
+			errs[i] = w.policy.Do(w.ctx, func() error { return w.post(d) })
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Webhook) post(d *delivery) error {
+	ctx, cancel := context.WithTimeout(w.ctx, w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.route.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, d.id)
+	req.Header.Set(KindHeader, d.kind)
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(w.secret, d.body))
+	}
+	for k, v := range d.route.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %w", d.route.URL, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("failed to post to %s: %s", d.route.URL, res.Status)
+	if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusRequestTimeout {
+		return retry.Permanent(err)
+	}
+	return err
+}
+
+// Sign returns the signature header value of the body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether the signature header value is valid for the body
+func VerifySignature(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// WithWebhookSecret sets the HMAC secret signing request bodies
+func WithWebhookSecret(secret []byte) WebhookOption {
+	return func(w *Webhook) error {
+		w.secret = secret
+		return nil
+	}
+}
+
+// WithWebhookTimeout sets the timeout of each request
+func WithWebhookTimeout(d time.Duration) WebhookOption {
+	return func(w *Webhook) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid timeout: %s", d)
+		}
+		w.timeout = d
+		return nil
+	}
+}
+
+// WithWebhookRetry sets the retry policy, 4xx responses except 408 and 429 are not retried
+func WithWebhookRetry(policy *retry.Policy) WebhookOption {
+	return func(w *Webhook) error {
+		if policy == nil {
+			return errors.New("retry policy is nil")
+		}
+		w.policy = policy
+		return nil
+	}
+}
+
+// WithWebhookContext sets the context of requests and retries, canceling it stops them
+func WithWebhookContext(ctx context.Context) WebhookOption {
+	return func(w *Webhook) error {
+		if ctx == nil {
+			return errors.New("context is nil")
+		}
+		w.ctx = ctx
+		return nil
+	}
+}
+
+// WithWebhookConcurrency sets the maximum number of concurrent requests
+func WithWebhookConcurrency(n int) WebhookOption {
+	return func(w *Webhook) error {
+		if n < 1 {
+			return fmt.Errorf("invalid concurrency: %d", n)
+		}
+		w.limit = n
+		return nil
+	}
+}
+
+// WithWebhookClient sets the HTTP client, ex) for TLS or proxies
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(w *Webhook) error {
+		if client == nil {
+			return errors.New("http client is nil")
+		}
+		w.client = client
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/retry"
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/tx"
+)
+
+func Test_Webhook(t *testing.T) {
+	secret := []byte("secret")
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifySignature(secret, body, r.Header.Get(SignatureHeader)) {
+			t.Error("invalid signature")
+		}
+		var st schema.Tx
+		if err := json.Unmarshal(body, &st); err != nil || st.ID != "tx1" || r.Header.Get(DeliveryHeader) != "tx1" {
+			t.Errorf("unexpected body: %s", body)
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // retried
+			return
+		}
+	}))
+	defer server.Close()
+
+	var rejected int32
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&rejected, 1)
+		w.WriteHeader(http.StatusBadRequest) // not retried
+	}))
+	defer rejecting.Close()
+
+	policy, _ := retry.New(retry.WithBackoff(time.Millisecond, time.Millisecond))
+	routes := []WebhookRoute{
+		{URL: server.URL},
+		{URL: rejecting.URL, Chaincode: "other"}, // filtered
+	}
+	w, err := NewWebhook(routes, WithWebhookSecret(secret), WithWebhookRetry(policy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t1 := &tx.Tx{
+		BlockNum:        1,
+		Header:          &common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: "tx1"},
+		SignatureHeader: &common.SignatureHeader{},
+	}
+	if err := w.Handle(t1); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+
+	routes[1].Chaincode = ""
+	w, _ = NewWebhook(routes[1:], WithWebhookRetry(policy))
+	if err := w.Handle(t1); !retry.IsPermanent(err) {
+		t.Errorf("expected permanent error, got %v", err)
+	}
+	if rejected != 1 {
+		t.Errorf("expected 1 call, got %d", rejected)
+	}
+}
@@ -0,0 +1,338 @@
+// Package stats aggregates transaction counts and block sizes over blocks, ex) for activity reports.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// Collector is a block handler aggregating the statistics of the blocks
+type Collector struct {
+	next     block.Handler
+	interval time.Duration
+
+	mutex      sync.Mutex
+	report     Report
+	counters   map[string]map[string]*Count // by dimension
+	blockSizes histogram
+	txPerBlock histogram
+	timeline   map[time.Time]*TimeBucket
+}
+
+type Option func(*Collector) error
+
+// NewCollector returns the collector, the next handler is called after the block is counted
+func NewCollector(next block.Handler, options ...Option) (*Collector, error) {
+	c := &Collector{
+		next:     next,
+		interval: time.Hour,
+		counters: map[string]map[string]*Count{},
+		timeline: map[time.Time]*TimeBucket{},
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, fmt.Errorf("failed to apply stats option: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// WithTimeBucket sets the interval of the time histogram, default is an hour
+func WithTimeBucket(d time.Duration) Option {
+	return func(c *Collector) error {
+		if d <= 0 {
+			return fmt.Errorf("time bucket must be positive: %s", d)
+		}
+		c.interval = d
+		return nil
+	}
+}
+
+func (c *Collector) Handle(b *block.Block) error {
+	c.add(b)
+	if c.next != nil {
+		return c.next.Handle(b)
+	}
+	return nil
+}
+
+func (c *Collector) add(b *block.Block) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r := &c.report
+	if r.Blocks == 0 || b.Num < r.FirstBlock {
+		r.FirstBlock = b.Num
+	}
+	if r.Blocks == 0 || b.Num > r.LastBlock {
+		r.LastBlock = b.Num
+	}
+	r.Blocks++
+	r.Txs += uint64(len(b.Txs))
+	if b.Block != nil {
+		c.blockSizes.add(uint64(proto.Size(b.Block)))
+	}
+	c.txPerBlock.add(uint64(len(b.Txs)))
+
+	if ts := b.Timestamp(); ts != nil {
+		t := ts.UTC()
+		if r.FirstTime == nil || t.Before(*r.FirstTime) {
+			r.FirstTime = &t
+		}
+		if r.LastTime == nil || t.After(*r.LastTime) {
+			r.LastTime = &t
+		}
+		start := t.Truncate(c.interval)
+		bucket := c.timeline[start]
+		if bucket == nil {
+			bucket = &TimeBucket{Start: start}
+			c.timeline[start] = bucket
+		}
+		bucket.Blocks++
+		bucket.Txs += uint64(len(b.Txs))
+	}
+
+	for _, t := range b.Txs {
+		c.addTx(t)
+	}
+}
+
+// addTx MUST be called with the lock, undecodable fields are not counted
+func (c *Collector) addTx(t *tx.Tx) {
+	valid := t.IsValid()
+	if !valid {
+		c.report.InvalidTxs++
+	}
+	c.count("type", t.HeaderType().String(), valid)
+	c.count("msp", t.MSPID(), valid)
+	c.count("validation", t.ValidationCode.String(), valid)
+	if t.HeaderType() != common.HeaderType_ENDORSER_TRANSACTION {
+		return
+	}
+
+	if spec, err := t.GetChaincodeInvocationSpec(); err == nil && spec != nil && spec.ChaincodeSpec != nil {
+		cc := ""
+		if spec.ChaincodeSpec.ChaincodeId != nil {
+			cc = spec.ChaincodeSpec.ChaincodeId.Name
+		}
+		c.count("chaincode", cc, valid)
+		if input := spec.ChaincodeSpec.Input; input != nil && len(input.Args) > 0 {
+			c.count("function", cc+"/"+string(input.Args[0]), valid)
+		}
+	}
+	if e, err := t.GetChaincodeEvent(); err == nil && e != nil && e.EventName != "" {
+		c.count("event", e.ChaincodeId+"/"+e.EventName, valid)
+	}
+}
+
+func (c *Collector) count(dimension, key string, valid bool) {
+	if key == "" {
+		return
+	}
+	counts := c.counters[dimension]
+	if counts == nil {
+		counts = map[string]*Count{}
+		c.counters[dimension] = counts
+	}
+	n := counts[key]
+	if n == nil {
+		n = &Count{Key: key}
+		counts[key] = n
+	}
+	n.Txs++
+	if !valid {
+		n.Invalid++
+	}
+}
+
+// Report returns the snapshot of the statistics
+func (c *Collector) Report() *Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	r := c.report
+	r.ByType = sortedCounts(c.counters["type"])
+	r.ByChaincode = sortedCounts(c.counters["chaincode"])
+	r.ByFunction = sortedCounts(c.counters["function"])
+	r.ByMSP = sortedCounts(c.counters["msp"])
+	r.ByValidation = sortedCounts(c.counters["validation"])
+	r.ByEvent = sortedCounts(c.counters["event"])
+	r.BlockSize = c.blockSizes.report()
+	r.TxPerBlock = c.txPerBlock.report()
+	r.Timeline = []TimeBucket{}
+	for _, b := range c.timeline {
+		r.Timeline = append(r.Timeline, *b)
+	}
+	sort.Slice(r.Timeline, func(i, j int) bool { return r.Timeline[i].Start.Before(r.Timeline[j].Start) })
+	return &r
+}
+
+type Report struct {
+	Blocks     uint64     `json:"blocks"`
+	FirstBlock uint64     `json:"first_block"`
+	LastBlock  uint64     `json:"last_block"`
+	FirstTime  *time.Time `json:"first_time,omitempty"`
+	LastTime   *time.Time `json:"last_time,omitempty"`
+	Txs        uint64     `json:"txs"`
+	InvalidTxs uint64     `json:"invalid_txs"`
+
+	// tx counts in descending order
+	ByType       []Count `json:"by_type"`
+	ByChaincode  []Count `json:"by_chaincode"`
+	ByFunction   []Count `json:"by_function"` // chaincode/function
+	ByMSP        []Count `json:"by_msp"`      // creator MSP ID
+	ByValidation []Count `json:"by_validation"`
+	ByEvent      []Count `json:"by_event"` // chaincode/event
+
+	BlockSize  Histogram    `json:"block_size"` // bytes
+	TxPerBlock Histogram    `json:"tx_per_block"`
+	Timeline   []TimeBucket `json:"timeline"`
+}
+
+type Count struct {
+	Key     string `json:"key"`
+	Txs     uint64 `json:"txs"`
+	Invalid uint64 `json:"invalid"`
+}
+
+// Histogram has power of 2 buckets, a bucket counts the values greater than the previous bound and less than or equal to LE
+type Histogram struct {
+	Min     uint64   `json:"min"`
+	Max     uint64   `json:"max"`
+	Avg     float64  `json:"avg"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+type Bucket struct {
+	LE    uint64 `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+type TimeBucket struct {
+	Start  time.Time `json:"start"`
+	Blocks uint64    `json:"blocks"`
+	Txs    uint64    `json:"txs"`
+}
+
+type histogram struct {
+	count, sum, min, max uint64
+	buckets              [65]uint64 // 0, 1, 2, 4, ..., 2^63
+}
+
+func (h *histogram) add(v uint64) {
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	i := 0
+	if v > 0 {
+		i = bits.Len64(v-1) + 1
+	}
+	if i >= len(h.buckets) {
+		i = len(h.buckets) - 1
+	}
+	h.buckets[i]++
+}
+
+func (h *histogram) report() Histogram {
+	r := Histogram{Min: h.min, Max: h.max, Buckets: []Bucket{}}
+	if h.count > 0 {
+		r.Avg = float64(h.sum) / float64(h.count)
+	}
+	for i, n := range h.buckets {
+		if n == 0 {
+			continue
+		}
+		le := uint64(0)
+		if i > 0 {
+			le = 1 << (i - 1)
+		}
+		r.Buckets = append(r.Buckets, Bucket{LE: le, Count: n})
+	}
+	return r
+}
+
+func sortedCounts(counts map[string]*Count) []Count {
+	sorted := []Count{}
+	for _, n := range counts {
+		sorted = append(sorted, *n)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Txs != sorted[j].Txs {
+			return sorted[i].Txs > sorted[j].Txs
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// WriteTable writes the report as tables for humans
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "BLOCKS\t%d\t(%d - %d)\n", r.Blocks, r.FirstBlock, r.LastBlock)
+	if r.FirstTime != nil && r.LastTime != nil {
+		fmt.Fprintf(tw, "TIME\t%s - %s\n", r.FirstTime.Format(time.RFC3339), r.LastTime.Format(time.RFC3339))
+	}
+	fmt.Fprintf(tw, "TXS\t%d\t(invalid %d)\n", r.Txs, r.InvalidTxs)
+
+	sections := []struct {
+		name   string
+		counts []Count
+	}{
+		{"TYPE", r.ByType},
+		{"CHAINCODE", r.ByChaincode},
+		{"FUNCTION", r.ByFunction},
+		{"MSP", r.ByMSP},
+		{"VALIDATION", r.ByValidation},
+		{"EVENT", r.ByEvent},
+	}
+	for _, s := range sections {
+		if len(s.counts) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s\tTXS\tINVALID\n", s.name)
+		for _, n := range s.counts {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", n.Key, n.Txs, n.Invalid)
+		}
+	}
+
+	histograms := []struct {
+		name string
+		h    Histogram
+	}{
+		{"BLOCK SIZE", r.BlockSize},
+		{"TX PER BLOCK", r.TxPerBlock},
+	}
+	for _, s := range histograms {
+		if len(s.h.Buckets) == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s <=\tBLOCKS\t(min %d, max %d, avg %.1f)\n", s.name, s.h.Min, s.h.Max, s.h.Avg)
+		for _, b := range s.h.Buckets {
+			fmt.Fprintf(tw, "%d\t%d\n", b.LE, b.Count)
+		}
+	}
+
+	if len(r.Timeline) > 0 {
+		fmt.Fprintln(tw, "\nTIME\tBLOCKS\tTXS")
+		for _, b := range r.Timeline {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", b.Start.Format(time.RFC3339), b.Blocks, b.Txs)
+		}
+	}
+	return tw.Flush()
+}
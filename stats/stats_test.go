@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+func Test_Collector(t *testing.T) {
+	c, err := NewCollector(nil, WithTimeBucket(time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	blocks := []*blocktest.Block{
+		blocktest.NewBlock(1).
+			AddEndorserTx("token", "transfer", "alice", "bob").Event("transfer", nil).
+			AddEndorserTx("token", "transfer", "bob", "carol").Invalid(peer.TxValidationCode_MVCC_READ_CONFLICT).
+			Block(),
+		blocktest.NewBlock(2).
+			AddEndorserTx("nft", "mint").WithMSPID("Org2MSP").
+			Block(),
+		blocktest.NewBlock(3),
+	}
+	for _, b := range blocks {
+		if err := c.Handle(b.Parse()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	r := c.Report()
+	if r.Blocks != 3 || r.FirstBlock != 1 || r.LastBlock != 3 || r.Txs != 3 || r.InvalidTxs != 1 {
+		t.Errorf("unexpected totals: %+v", r)
+	}
+	if len(r.ByFunction) != 2 || r.ByFunction[0] != (Count{Key: "token/transfer", Txs: 2, Invalid: 1}) {
+		t.Errorf("unexpected functions: %+v", r.ByFunction)
+	}
+	if len(r.ByMSP) != 2 || r.ByMSP[1] != (Count{Key: "Org2MSP", Txs: 1}) {
+		t.Errorf("unexpected MSPs: %+v", r.ByMSP)
+	}
+	if len(r.ByValidation) != 2 || r.ByValidation[1].Key != "MVCC_READ_CONFLICT" {
+		t.Errorf("unexpected validation codes: %+v", r.ByValidation)
+	}
+	if len(r.ByEvent) != 1 || r.ByEvent[0].Key != "token/transfer" {
+		t.Errorf("unexpected events: %+v", r.ByEvent)
+	}
+	if len(r.TxPerBlock.Buckets) != 3 || r.TxPerBlock.Buckets[2] != (Bucket{LE: 2, Count: 1}) || r.TxPerBlock.Max != 2 {
+		t.Errorf("unexpected tx per block: %+v", r.TxPerBlock)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteTable(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "token/transfer  2    1") {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+}
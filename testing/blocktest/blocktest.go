@@ -0,0 +1,337 @@
+// Package blocktest builds synthetic blocks and transactions for tests,
+// they are parsed by block.New and tx.Tx like the blocks delivered from peers.
+//
+//	b := blocktest.NewBlock(1).
+//		AddEndorserTx("token", "transfer", "alice", "bob", "10").
+//		Write("token", "alice", []byte("90")).
+//		Event("transfer", payload).
+//		Build()
+package blocktest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+const (
+	DefaultChannel = "testchannel"
+	DefaultMSPID   = "Org1MSP"
+)
+
+// DefaultTime is the timestamp of block 0, block n is DefaultTime + n seconds by default
+var DefaultTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Block is a block builder
+type Block struct {
+	num      uint64
+	prevHash []byte
+	channel  string
+	time     time.Time
+	txs      []*Tx
+}
+
+func NewBlock(num uint64) *Block {
+	return &Block{
+		num:     num,
+		channel: DefaultChannel,
+		time:    DefaultTime.Add(time.Duration(num) * time.Second),
+	}
+}
+
+// WithPrevHash sets the previous block hash, see Chain for hash chaining
+func (b *Block) WithPrevHash(hash []byte) *Block {
+	b.prevHash = hash
+	return b
+}
+
+func (b *Block) WithChannel(channelID string) *Block {
+	b.channel = channelID
+	return b
+}
+
+// WithTime sets the default timestamp of the transactions
+func (b *Block) WithTime(t time.Time) *Block {
+	b.time = t
+	return b
+}
+
+// AddEndorserTx adds an endorser transaction invoking the chaincode function and returns the tx builder
+func (b *Block) AddEndorserTx(chaincode, fcn string, args ...string) *Tx {
+	t := &Tx{
+		block:     b,
+		seq:       len(b.txs),
+		mspID:     DefaultMSPID,
+		chaincode: chaincode,
+		args:      append([]string{fcn}, args...),
+		status:    200,
+		code:      peer.TxValidationCode_VALID,
+	}
+	b.txs = append(b.txs, t)
+	return t
+}
+
+// Build returns the block with the data hash and the transactions filter
+func (b *Block) Build() *common.Block {
+	data := [][]byte{}
+	filter := []byte{}
+	for _, t := range b.txs {
+		data = append(data, t.envelope())
+		filter = append(filter, byte(t.code))
+	}
+	dataHash := sha256.Sum256(bytes.Join(data, nil))
+	return &common.Block{
+		Header: &common.BlockHeader{
+			Number:       b.num,
+			PreviousHash: b.prevHash,
+			DataHash:     dataHash[:],
+		},
+		Data: &common.BlockData{Data: data},
+		Metadata: &common.BlockMetadata{
+			Metadata: [][]byte{{}, {}, filter, {}, {}}, // SIGNATURES, LAST_CONFIG, TRANSACTIONS_FILTER, ORDERER, COMMIT_HASH
+		},
+	}
+}
+
+// Parse returns the built block parsed by block.New, it panics on error
+func (b *Block) Parse() *block.Block {
+	pb, err := block.New(b.Build())
+	if err != nil {
+		panic(err)
+	}
+	return pb
+}
+
+// Chain builds the blocks in order, chaining the previous hash of each block to the hash of the former block
+func Chain(blocks ...*Block) []*common.Block {
+	chain := []*common.Block{}
+	for i, b := range blocks {
+		if i > 0 {
+			hash, err := block.GenerateHash(chain[i-1])
+			if err != nil {
+				panic(err)
+			}
+			b.prevHash = hash
+		}
+		chain = append(chain, b.Build())
+	}
+	return chain
+}
+
+// Tx is an endorser transaction builder
+type Tx struct {
+	block     *Block
+	seq       int
+	id        string
+	mspID     string
+	time      *time.Time
+	chaincode string
+	args      []string
+	reads     map[string][]*kvrwset.KVRead
+	writes    map[string][]*kvrwset.KVWrite
+	ns        []string // namespaces in order
+	event     *peer.ChaincodeEvent
+	status    int32
+	message   string
+	payload   []byte
+	code      peer.TxValidationCode
+}
+
+// AddEndorserTx adds the next transaction to the block
+func (t *Tx) AddEndorserTx(chaincode, fcn string, args ...string) *Tx {
+	return t.block.AddEndorserTx(chaincode, fcn, args...)
+}
+
+// Block returns the block builder
+func (t *Tx) Block() *Block {
+	return t.block
+}
+
+// Build builds the block of the transaction
+func (t *Tx) Build() *common.Block {
+	return t.block.Build()
+}
+
+// WithID sets the tx ID, default is derived from the block number and the sequence
+func (t *Tx) WithID(txID string) *Tx {
+	t.id = txID
+	return t
+}
+
+func (t *Tx) WithMSPID(mspID string) *Tx {
+	t.mspID = mspID
+	return t
+}
+
+func (t *Tx) WithTime(ts time.Time) *Tx {
+	t.time = &ts
+	return t
+}
+
+// WithResponse sets the chaincode response, default status is 200
+func (t *Tx) WithResponse(status int32, message string, payload []byte) *Tx {
+	t.status, t.message, t.payload = status, message, payload
+	return t
+}
+
+func (t *Tx) Read(ns, key string, blockNum, txNum uint64) *Tx {
+	t.namespace(ns)
+	if t.reads == nil {
+		t.reads = map[string][]*kvrwset.KVRead{}
+	}
+	t.reads[ns] = append(t.reads[ns], &kvrwset.KVRead{Key: key, Version: &kvrwset.Version{BlockNum: blockNum, TxNum: txNum}})
+	return t
+}
+
+func (t *Tx) Write(ns, key string, value []byte) *Tx {
+	return t.write(ns, &kvrwset.KVWrite{Key: key, Value: value})
+}
+
+func (t *Tx) Delete(ns, key string) *Tx {
+	return t.write(ns, &kvrwset.KVWrite{Key: key, IsDelete: true})
+}
+
+func (t *Tx) write(ns string, w *kvrwset.KVWrite) *Tx {
+	t.namespace(ns)
+	if t.writes == nil {
+		t.writes = map[string][]*kvrwset.KVWrite{}
+	}
+	t.writes[ns] = append(t.writes[ns], w)
+	return t
+}
+
+func (t *Tx) namespace(ns string) {
+	for _, n := range t.ns {
+		if n == ns {
+			return
+		}
+	}
+	t.ns = append(t.ns, ns)
+}
+
+// Event sets the chaincode event
+func (t *Tx) Event(name string, payload []byte) *Tx {
+	t.event = &peer.ChaincodeEvent{ChaincodeId: t.chaincode, EventName: name, Payload: payload}
+	return t
+}
+
+// Invalid sets the validation code
+func (t *Tx) Invalid(code peer.TxValidationCode) *Tx {
+	t.code = code
+	return t
+}
+
+// ID returns the tx ID
+func (t *Tx) ID() string {
+	if t.id != "" {
+		return t.id
+	}
+	// Fabric computes sha256(nonce + creator), the nonce is derived from the position here
+	sum := sha256.Sum256(append(t.nonce(), t.creator()...))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *Tx) nonce() []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("blocktest/%s/%d/%d", t.block.channel, t.block.num, t.seq)))
+	return sum[:24]
+}
+
+func (t *Tx) creator() []byte {
+	return marshal(&msp.SerializedIdentity{
+		Mspid:   t.mspID,
+		IdBytes: []byte(fmt.Sprintf("-----BEGIN CERTIFICATE-----\n%s\n-----END CERTIFICATE-----\n", t.mspID)),
+	})
+}
+
+func (t *Tx) envelope() []byte {
+	ts := t.block.time
+	if t.time != nil {
+		ts = *t.time
+	}
+	txID := t.ID()
+	ccID := &peer.ChaincodeID{Name: t.chaincode}
+
+	channelHeader := marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: t.block.channel,
+		TxId:      txID,
+		Timestamp: &timestamp.Timestamp{Seconds: ts.Unix(), Nanos: int32(ts.Nanosecond())},
+		Extension: marshal(&peer.ChaincodeHeaderExtension{ChaincodeId: ccID}),
+	})
+	signatureHeader := marshal(&common.SignatureHeader{Creator: t.creator(), Nonce: t.nonce()})
+
+	args := [][]byte{}
+	for _, arg := range t.args {
+		args = append(args, []byte(arg))
+	}
+	proposalPayload := marshal(&peer.ChaincodeProposalPayload{
+		Input: marshal(&peer.ChaincodeInvocationSpec{
+			ChaincodeSpec: &peer.ChaincodeSpec{
+				Type:        peer.ChaincodeSpec_GOLANG,
+				ChaincodeId: ccID,
+				Input:       &peer.ChaincodeInput{Args: args},
+			},
+		}),
+	})
+
+	results := &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV}
+	for _, ns := range t.ns {
+		results.NsRwset = append(results.NsRwset, &rwset.NsReadWriteSet{
+			Namespace: ns,
+			Rwset:     marshal(&kvrwset.KVRWSet{Reads: t.reads[ns], Writes: t.writes[ns]}),
+		})
+	}
+	action := &peer.ChaincodeAction{
+		Results:     marshal(results),
+		Response:    &peer.Response{Status: t.status, Message: t.message, Payload: t.payload},
+		ChaincodeId: ccID,
+	}
+	if t.event != nil {
+		event := *t.event
+		event.TxId = txID
+		action.Events = marshal(&event)
+	}
+	proposalHash := sha256.Sum256(append(append(channelHeader, signatureHeader...), proposalPayload...))
+	responsePayload := marshal(&peer.ProposalResponsePayload{ProposalHash: proposalHash[:], Extension: marshal(action)})
+
+	transaction := marshal(&peer.Transaction{
+		Actions: []*peer.TransactionAction{{
+			Header: signatureHeader,
+			Payload: marshal(&peer.ChaincodeActionPayload{
+				ChaincodeProposalPayload: proposalPayload,
+				Action: &peer.ChaincodeEndorsedAction{
+					ProposalResponsePayload: responsePayload,
+					Endorsements:            []*peer.Endorsement{{Endorser: t.creator(), Signature: []byte("signature")}},
+				},
+			}),
+		}},
+	})
+	return marshal(&common.Envelope{
+		Payload: marshal(&common.Payload{
+			Header: &common.Header{ChannelHeader: channelHeader, SignatureHeader: signatureHeader},
+			Data:   transaction,
+		}),
+		Signature: []byte("signature"),
+	})
+}
+
+// marshal panics on error, messages built here are always valid
+func marshal(m proto.Message) []byte {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,64 @@
+package blocktest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/blockfile"
+	"github.com/key-inside/patrasche/schema"
+)
+
+func Test_Builder(t *testing.T) {
+	chain := Chain(
+		NewBlock(0).AddEndorserTx("token", "init").Block(),
+		NewBlock(1).
+			AddEndorserTx("token", "transfer", "alice", "bob", "10").
+			Read("token", "alice", 0, 0).
+			Write("token", "alice", []byte("90")).
+			Write("token", "bob", []byte("10")).
+			Event("transfer", []byte(`{"amount":10}`)).
+			AddEndorserTx("token", "transfer", "bob", "carol", "100").
+			WithResponse(500, "insufficient balance", nil).
+			Invalid(peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE).
+			Block(),
+	)
+
+	prev, _ := block.GenerateHash(chain[0])
+	if !bytes.Equal(chain[1].Header.PreviousHash, prev) {
+		t.Error("previous hash is not chained")
+	}
+	if !bytes.Equal(chain[1].Header.DataHash, blockfile.DataHash(chain[1].Data)) {
+		t.Error("invalid data hash")
+	}
+
+	b, err := block.New(chain[1])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(b.Txs) != 2 || !b.Txs[0].IsValid() || b.Txs[1].IsValid() {
+		t.Fatalf("unexpected txs: %v", b.Txs)
+	}
+	if ts := b.Timestamp(); ts == nil || !ts.UTC().Equal(DefaultTime.Add(1e9)) {
+		t.Errorf("unexpected block timestamp: %v", ts)
+	}
+
+	st, err := schema.NewTx(b.Txs[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if st.Chaincode != "token" || st.MSPID != DefaultMSPID || len(st.Args) != 4 || st.Args[0] != "transfer" {
+		t.Errorf("unexpected tx: %+v", st)
+	}
+	if st.Event == nil || st.Event.Name != "transfer" || st.Event.TxID != st.ID {
+		t.Errorf("unexpected event: %+v", st.Event)
+	}
+	if len(st.Writes) != 2 || st.Writes[1].Key != "bob" || string(st.Writes[1].Value) != "10" {
+		t.Errorf("unexpected writes: %+v", st.Writes)
+	}
+	if st, _ = schema.NewTx(b.Txs[1]); st.Status != 500 || st.ID == b.Txs[0].ID() {
+		t.Errorf("unexpected tx: %+v", st)
+	}
+}
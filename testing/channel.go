@@ -0,0 +1,353 @@
+// Package testing provides an in-memory fake channel for unit-testing handlers, listeners
+// and chaincode clients deterministically without a Fabric network.
+//
+//	import ptesting "github.com/key-inside/patrasche/testing"
+package testing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+
+	"github.com/key-inside/patrasche/block"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// ChaincodeFunc returns the payload of a scripted chaincode for the request
+type ChaincodeFunc func(request channel.Request) ([]byte, error)
+
+// Channel is a fake channel serving scripted blocks and chaincodes.
+// Its ledger and chaincode methods have the same signatures as the patrasche clients,
+// so it satisfies application interfaces declared for them.
+type Channel struct {
+	mutex       sync.Mutex
+	blocks      []*block.Block
+	first       uint64
+	appended    chan struct{} // closed and replaced when blocks are appended
+	sources     map[*Source]struct{}
+	chaincodes  map[string]ChaincodeFunc
+	invocations []channel.Request
+}
+
+func NewChannel() *Channel {
+	return &Channel{
+		appended:   make(chan struct{}),
+		sources:    map[*Source]struct{}{},
+		chaincodes: map[string]ChaincodeFunc{},
+	}
+}
+
+// AddBlocks appends blocks to the ledger and delivers them to the listening sources.
+// Block numbers must be contiguous, the first block can start from any number.
+func (c *Channel) AddBlocks(blocks ...*common.Block) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, cb := range blocks {
+		b, err := block.New(cb)
+		if err != nil {
+			return fmt.Errorf("failed to parse block data: %w", err)
+		}
+		if len(c.blocks) == 0 {
+			c.first = b.Num
+		} else if b.Num != c.height() {
+			return fmt.Errorf("unexpected block number %d, expected %d", b.Num, c.height())
+		}
+		c.blocks = append(c.blocks, b)
+	}
+	close(c.appended)
+	c.appended = make(chan struct{})
+	return nil
+}
+
+// Height returns the next block number of the last block
+func (c *Channel) Height() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.height()
+}
+
+// height MUST be called with the lock
+func (c *Channel) height() uint64 {
+	return c.first + uint64(len(c.blocks))
+}
+
+// block returns the block or the channel closed when a block is appended
+func (c *Channel) block(num uint64) (*block.Block, <-chan struct{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.blocks) == 0 || num < c.first || num >= c.height() {
+		return nil, c.appended
+	}
+	return c.blocks[num-c.first], nil
+}
+
+// NewSource returns a block source of the channel for listener.New
+func (c *Channel) NewSource() *Source {
+	s := &Source{ch: c, done: make(chan struct{}), disconnected: make(chan struct{})}
+	c.mutex.Lock()
+	c.sources[s] = struct{}{}
+	c.mutex.Unlock()
+	return s
+}
+
+// Disconnect ends the streams of all sources with the error, ex) testing reconnect logic
+func (c *Channel) Disconnect(err error) {
+	c.mutex.Lock()
+	sources := c.sources
+	c.sources = map[*Source]struct{}{}
+	c.mutex.Unlock()
+	for s := range sources {
+		s.disconnect(err)
+	}
+}
+
+// Close ends the streams of all sources normally
+func (c *Channel) Close() {
+	c.Disconnect(nil)
+}
+
+// SetChaincode scripts the chaincode for Query and Execute
+func (c *Channel) SetChaincode(ccID string, fn ChaincodeFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.chaincodes[ccID] = fn
+}
+
+// Invocations returns the requests executed so far
+func (c *Channel) Invocations() []channel.Request {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]channel.Request{}, c.invocations...)
+}
+
+func (c *Channel) Query(request channel.Request, options ...channel.RequestOption) (channel.Response, error) {
+	return c.call(request, false)
+}
+
+func (c *Channel) Execute(request channel.Request, options ...channel.RequestOption) (channel.Response, error) {
+	return c.call(request, true)
+}
+
+func (c *Channel) call(request channel.Request, execute bool) (channel.Response, error) {
+	c.mutex.Lock()
+	fn, ok := c.chaincodes[request.ChaincodeID]
+	if execute {
+		c.invocations = append(c.invocations, request)
+	}
+	seq := len(c.invocations)
+	c.mutex.Unlock()
+	if !ok {
+		return channel.Response{}, fmt.Errorf("chaincode not found: %s", request.ChaincodeID)
+	}
+	payload, err := fn(request)
+	if err != nil {
+		return channel.Response{}, err
+	}
+	// deterministic tx ID
+	txID := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", request.ChaincodeID, request.Fcn, seq)))
+	return channel.Response{
+		TransactionID:    fab.TransactionID(fmt.Sprintf("%x", txID)),
+		TxValidationCode: pb.TxValidationCode_VALID,
+		ChaincodeStatus:  200,
+		Payload:          payload,
+	}, nil
+}
+
+func (c *Channel) QueryInfo(options ...ledger.RequestOption) (*ldgclient.BlockchainInfoResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	bci := &common.BlockchainInfo{Height: c.height()}
+	if n := len(c.blocks); n > 0 {
+		last := c.blocks[n-1]
+		bci.CurrentBlockHash = last.Hash
+		bci.PreviousBlockHash = last.Header.PreviousHash
+	}
+	return &ldgclient.BlockchainInfoResponse{BlockchainInfoResponse: &fab.BlockchainInfoResponse{BCI: bci, Status: 200}}, nil
+}
+
+// QueryBlock returns ldgclient.ErrBlockNotFound if the block is not added
+func (c *Channel) QueryBlock(blockNumber uint64, options ...ledger.RequestOption) (*block.Block, error) {
+	b, _ := c.block(blockNumber)
+	if b == nil {
+		return nil, ldgclient.ErrBlockNotFound
+	}
+	return b, nil
+}
+
+func (c *Channel) QueryBlockByHash(blockHash []byte, options ...ledger.RequestOption) (*block.Block, error) {
+	return c.find(func(b *block.Block) bool { return bytes.Equal(b.Hash, blockHash) })
+}
+
+func (c *Channel) QueryBlockByTxID(txID string, options ...ledger.RequestOption) (*block.Block, error) {
+	return c.find(func(b *block.Block) bool {
+		for _, t := range b.Txs {
+			if t.ID() == txID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (c *Channel) find(f func(*block.Block) bool) (*block.Block, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, b := range c.blocks {
+		if f(b) {
+			return b, nil
+		}
+	}
+	return nil, ldgclient.ErrBlockNotFound
+}
+
+func (c *Channel) QueryTransaction(txID string, options ...ledger.RequestOption) (*tx.Tx, error) {
+	b, err := c.QueryBlockByTxID(txID)
+	if err != nil {
+		return nil, fmt.Errorf("tx not found: %s", txID)
+	}
+	for _, t := range b.Txs {
+		if t.ID() == txID {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("tx disappeared") // never here
+}
+
+// BlockTime returns the block timestamp, a block without transactions has the zero time
+func (c *Channel) BlockTime(blockNumber uint64, options ...ledger.RequestOption) (time.Time, error) {
+	b, err := c.QueryBlock(blockNumber)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ts := b.Timestamp(); ts != nil {
+		return ts.UTC(), nil
+	}
+	return time.Time{}, nil
+}
+
+func (c *Channel) FindBlockByTime(t time.Time, options ...ledger.RequestOption) (uint64, error) {
+	i := c.search(func(bt time.Time) bool { return !bt.Before(t) })
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if i >= len(c.blocks) {
+		return 0, fmt.Errorf("no block at or after %s: %w", t.UTC().Format(time.RFC3339Nano), ldgclient.ErrBlockNotFound)
+	}
+	return c.blocks[i].Num, nil
+}
+
+func (c *Channel) FindLastBlockByTime(t time.Time, options ...ledger.RequestOption) (uint64, error) {
+	i := c.search(func(bt time.Time) bool { return bt.After(t) })
+	if i == 0 {
+		return 0, fmt.Errorf("no block at or before %s: %w", t.UTC().Format(time.RFC3339Nano), ldgclient.ErrBlockNotFound)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.blocks[i-1].Num, nil
+}
+
+func (c *Channel) search(f func(time.Time) bool) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return sort.Search(len(c.blocks), func(i int) bool {
+		var bt time.Time
+		if ts := c.blocks[i].Timestamp(); ts != nil {
+			bt = ts.UTC()
+		}
+		return f(bt)
+	})
+}
+
+// Source is a block source of the fake channel, it implements listener.BlockSource and listener.HeightSource.
+// Like the deliver service, it waits for new blocks at the tip until it is closed or disconnected.
+type Source struct {
+	ch           *Channel
+	done         chan struct{}
+	disconnected chan struct{}
+	once         sync.Once
+	mutex        sync.Mutex
+	err          error
+}
+
+func (s *Source) Blocks(start *uint64) (<-chan *common.Block, error) {
+	select {
+	case <-s.disconnected:
+		return nil, errors.New("source is disconnected")
+	default:
+	}
+	next := s.ch.Height() // newest
+	if start != nil {
+		next = *start
+	}
+	out := make(chan *common.Block)
+	go func() {
+		defer close(out)
+		for {
+			select { // stopped before delivering the next block
+			case <-s.done:
+				return
+			case <-s.disconnected:
+				return
+			default:
+			}
+			b, appended := s.ch.block(next)
+			if b == nil {
+				select {
+				case <-appended:
+					continue
+				case <-s.done:
+				case <-s.disconnected:
+				}
+				return
+			}
+			select {
+			case out <- b.Block:
+				next++
+			case <-s.done:
+				return
+			case <-s.disconnected:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *Source) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+func (s *Source) Close() error {
+	s.once.Do(func() { close(s.done) })
+	s.ch.mutex.Lock()
+	delete(s.ch.sources, s)
+	s.ch.mutex.Unlock()
+	return nil
+}
+
+func (s *Source) Height() (uint64, error) {
+	return s.ch.Height(), nil
+}
+
+func (s *Source) disconnect(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.disconnected:
+	default:
+		s.err = err
+		close(s.disconnected)
+	}
+}
@@ -0,0 +1,97 @@
+package testing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+
+	"github.com/key-inside/patrasche/block"
+	ldgclient "github.com/key-inside/patrasche/client/ledger"
+	"github.com/key-inside/patrasche/listener"
+)
+
+func emptyBlocks(from, to uint64) []*common.Block {
+	blocks := []*common.Block{}
+	for i := from; i <= to; i++ {
+		blocks = append(blocks, &common.Block{
+			Header:   &common.BlockHeader{Number: i},
+			Data:     &common.BlockData{},
+			Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {}, {}, {}}},
+		})
+	}
+	return blocks
+}
+
+func Test_ChannelListen(t *testing.T) {
+	ch := NewChannel()
+	if err := ch.AddBlocks(emptyBlocks(0, 4)...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ch.AddBlocks(emptyBlocks(6, 6)...); err == nil {
+		t.Error("expected non-contiguous block error")
+	}
+
+	nums := []uint64{}
+	handler := block.HandlerFunc(func(b *block.Block) error {
+		nums = append(nums, b.Num)
+		if b.Num == 6 {
+			ch.Disconnect(errors.New("connection lost"))
+		}
+		return nil
+	})
+
+	// stop condition
+	l, _ := listener.New(ch.NewSource(), handler, listener.WithStartBlock(1), listener.WithStopAtHeight())
+	if err := l.Listen(); err != nil || l.StopReason() != listener.StopReasonCaughtUp || len(nums) != 4 {
+		t.Fatalf("unexpected result: %v, %v, %v", nums, l.StopReason(), err)
+	}
+
+	// waits for new blocks at the tip and ends by disconnection
+	go ch.AddBlocks(emptyBlocks(5, 8)...)
+	nums = nums[:0]
+	l, _ = listener.New(ch.NewSource(), handler, listener.WithStartBlock(5))
+	if err := l.Listen(); err == nil || l.StopReason() != listener.StopReasonError {
+		t.Fatalf("expected disconnection, got %v, %v", l.StopReason(), err)
+	}
+	if len(nums) != 2 || nums[1] != 6 {
+		t.Errorf("unexpected blocks: %v", nums)
+	}
+}
+
+func Test_ChannelQuery(t *testing.T) {
+	ch := NewChannel()
+	ch.AddBlocks(emptyBlocks(10, 12)...)
+	ch.SetChaincode("kiesnet-id", func(req channel.Request) ([]byte, error) {
+		if req.Fcn != "get" {
+			return nil, errors.New("unknown function")
+		}
+		return req.Args[0], nil
+	})
+
+	res, err := ch.Query(channel.Request{ChaincodeID: "kiesnet-id", Fcn: "get", Args: [][]byte{[]byte("abc")}})
+	if err != nil || string(res.Payload) != "abc" {
+		t.Errorf("unexpected response: %v, %v", res, err)
+	}
+	if _, err = ch.Execute(channel.Request{ChaincodeID: "kiesnet-id", Fcn: "put"}); err == nil {
+		t.Error("expected chaincode error")
+	}
+	if _, err = ch.Query(channel.Request{ChaincodeID: "unknown"}); err == nil {
+		t.Error("expected not found error")
+	}
+	if n := len(ch.Invocations()); n != 1 {
+		t.Errorf("expected 1 invocation, got %d", n)
+	}
+
+	info, _ := ch.QueryInfo()
+	if info.BCI.Height != 13 {
+		t.Errorf("expected height 13, got %d", info.BCI.Height)
+	}
+	if b, err := ch.QueryBlock(11); err != nil || b.Num != 11 {
+		t.Errorf("unexpected block: %v", err)
+	}
+	if _, err := ch.QueryBlock(9); !errors.Is(err, ldgclient.ErrBlockNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
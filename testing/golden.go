@@ -0,0 +1,75 @@
+package testing
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/key-inside/patrasche/schema"
+	"github.com/key-inside/patrasche/tx"
+)
+
+// UpdateGolden writes golden files instead of comparing, it is set by the UPDATE_GOLDEN environment variable.
+//
+//	% UPDATE_GOLDEN=1 go test ./...
+var UpdateGolden = os.Getenv("UPDATE_GOLDEN") != ""
+
+// AssertGolden compares the indented JSON of v with the golden file, ex) testdata/txs.golden.json
+func AssertGolden(t testing.TB, path string, v interface{}) {
+	t.Helper()
+	actual, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal golden value: %v", err)
+	}
+	actual = append(actual, '\n')
+
+	if UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, UPDATE_GOLDEN=1 writes it: %v", err)
+	}
+	var e, a interface{}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		t.Fatalf("invalid golden file %s: %v", path, err)
+	}
+	json.Unmarshal(actual, &a)
+	if !reflect.DeepEqual(e, a) {
+		t.Errorf("output mismatches the golden file %s\n--- expected\n%s--- actual\n%s", path, expected, actual)
+	}
+}
+
+// TxCollector is a tx handler collecting the stable representation of transactions for golden files
+type TxCollector struct {
+	mutex sync.Mutex
+	txs   []*schema.Tx
+}
+
+func (c *TxCollector) Handle(t *tx.Tx) error {
+	st, err := schema.NewTx(t)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.txs = append(c.txs, st)
+	return nil
+}
+
+// Txs returns the collected transactions in order
+func (c *TxCollector) Txs() []*schema.Tx {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]*schema.Tx{}, c.txs...)
+}
@@ -0,0 +1,220 @@
+package testing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+
+	"github.com/key-inside/patrasche/block"
+)
+
+// TimelineName is the file recording the received time of blocks in a fixture directory
+const TimelineName = "timeline.jsonl"
+
+// TimelineEntry is a line of the timeline file
+type TimelineEntry struct {
+	Block uint64    `json:"block"`
+	File  string    `json:"file"`
+	Time  time.Time `json:"time"` // received
+}
+
+// Recorder is a block handler writing raw blocks to a fixture directory,
+// a block per file (<number>.block, marshaled common.Block) and the timeline.
+// The timeline is appended, so blocks recorded again replace the earlier ones on replay.
+type Recorder struct {
+	next block.Handler
+	dir  string
+
+	mutex    sync.Mutex
+	timeline *os.File
+}
+
+func NewRecorder(next block.Handler, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	timeline, err := os.OpenFile(filepath.Join(dir, TimelineName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open timeline: %w", err)
+	}
+	return &Recorder{next: next, dir: dir, timeline: timeline}, nil
+}
+
+func (r *Recorder) Handle(b *block.Block) error {
+	if err := r.record(b); err != nil {
+		return err
+	}
+	if r.next != nil {
+		return r.next.Handle(b)
+	}
+	return nil
+}
+
+func (r *Recorder) record(b *block.Block) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	data, err := proto.Marshal(b.Block)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block: %w", err)
+	}
+	e := TimelineEntry{Block: b.Num, File: fmt.Sprintf("%020d.block", b.Num), Time: time.Now().UTC()}
+	if err := os.WriteFile(filepath.Join(r.dir, e.File), data, 0644); err != nil {
+		return fmt.Errorf("failed to write block: %w", err)
+	}
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	if _, err := r.timeline.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write timeline: %w", err)
+	}
+	return nil
+}
+
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.timeline.Close()
+}
+
+// ReplaySource is a block source feeding recorded blocks to the listener, it implements listener.HeightSource.
+// The stream ends after the last recorded block.
+type ReplaySource struct {
+	dir      string
+	timeline []TimelineEntry
+	speed    float64
+	done     chan struct{}
+	once     sync.Once
+	err      error
+}
+
+type ReplayOption func(*ReplaySource) error
+
+// NewReplaySource returns a source of the fixture directory written by Recorder.
+// By default, blocks are fed as fast as possible.
+func NewReplaySource(dir string, options ...ReplayOption) (*ReplaySource, error) {
+	timeline, err := loadTimeline(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &ReplaySource{dir: dir, timeline: timeline, done: make(chan struct{})}
+	for _, option := range options {
+		if err := option(s); err != nil {
+			return nil, fmt.Errorf("failed to apply replay option: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func loadTimeline(dir string) ([]TimelineEntry, error) {
+	f, err := os.Open(filepath.Join(dir, TimelineName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open timeline: %w", err)
+	}
+	defer f.Close()
+
+	timeline := []TimelineEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e TimelineEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid timeline: %w", err)
+		}
+		timeline = append(timeline, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read timeline: %w", err)
+	}
+
+	// blocks recorded again into the same directory are appended, the last one is the recorded file
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].Block < timeline[j].Block })
+	deduped := timeline[:0]
+	for _, e := range timeline {
+		if n := len(deduped); n > 0 && deduped[n-1].Block == e.Block {
+			deduped[n-1] = e
+			continue
+		}
+		deduped = append(deduped, e)
+	}
+	return deduped, nil
+}
+
+// Blocks starts feeding from the start block number, nil start is the first recorded block
+func (s *ReplaySource) Blocks(start *uint64) (<-chan *common.Block, error) {
+	out := make(chan *common.Block)
+	go func() {
+		defer close(out)
+		var prev *TimelineEntry
+		for i := range s.timeline {
+			e := &s.timeline[i]
+			if start != nil && e.Block < *start {
+				continue
+			}
+			if prev != nil && s.speed > 0 {
+				timer := time.NewTimer(time.Duration(float64(e.Time.Sub(prev.Time)) / s.speed))
+				select {
+				case <-timer.C:
+				case <-s.done:
+					timer.Stop()
+					return
+				}
+			}
+			prev = e
+
+			data, err := os.ReadFile(filepath.Join(s.dir, e.File))
+			if err != nil {
+				s.err = fmt.Errorf("failed to read block %d: %w", e.Block, err)
+				return
+			}
+			b := &common.Block{}
+			if err := proto.Unmarshal(data, b); err != nil {
+				s.err = fmt.Errorf("failed to unmarshal block %d: %w", e.Block, err)
+				return
+			}
+			select {
+			case out <- b:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *ReplaySource) Err() error {
+	return s.err
+}
+
+func (s *ReplaySource) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+// Height returns the next block number of the last recorded block
+func (s *ReplaySource) Height() (uint64, error) {
+	if len(s.timeline) == 0 {
+		return 0, nil
+	}
+	return s.timeline[len(s.timeline)-1].Block + 1, nil
+}
+
+// WithSpeed feeds blocks at the recorded pace multiplied by the factor, ex) 1 is the original pace and 10 is 10x faster
+func WithSpeed(factor float64) ReplayOption {
+	return func(s *ReplaySource) error {
+		if factor < 0 {
+			return errors.New("negative replay speed")
+		}
+		s.speed = factor
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/key-inside/patrasche/block"
+	"github.com/key-inside/patrasche/listener"
+	"github.com/key-inside/patrasche/testing/blocktest"
+)
+
+func Test_RecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	ch := NewChannel()
+	ch.AddBlocks(blocktest.Chain(
+		blocktest.NewBlock(0).AddEndorserTx("token", "init").Block(),
+		blocktest.NewBlock(1).
+			AddEndorserTx("token", "transfer", "alice", "bob", "10").
+			Write("token", "alice", []byte("90")).
+			Event("transfer", []byte(`{"amount":10}`)).
+			Block(),
+		blocktest.NewBlock(2).AddEndorserTx("token", "burn", "bob", "1").Delete("token", "bob").Block(),
+	)...)
+
+	// record
+	recorder, err := NewRecorder(nil, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	l, _ := listener.New(ch.NewSource(), recorder, listener.WithStartBlock(0), listener.WithStopAtHeight())
+	if err := l.Listen(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	recorder.Close()
+
+	// record again from block 1 into the same directory
+	recorder, err = NewRecorder(nil, dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	l, _ = listener.New(ch.NewSource(), recorder, listener.WithStartBlock(1), listener.WithStopAtHeight())
+	if err := l.Listen(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	recorder.Close()
+	timeline, err := loadTimeline(dir)
+	if err != nil || len(timeline) != 3 {
+		t.Fatalf("expected 3 timeline entries, got %v, %v", timeline, err)
+	}
+
+	// replay
+	source, err := NewReplaySource(dir, WithSpeed(1000))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	collector := &TxCollector{}
+	handler, _ := block.NewStdHandler(collector)
+	l, _ = listener.New(source, handler, listener.WithStartBlock(1), listener.WithStopAtHeight())
+	if err := l.Listen(); err != nil || l.StopReason() != listener.StopReasonCaughtUp {
+		t.Fatalf("unexpected result: %v, %v", l.StopReason(), err)
+	}
+	AssertGolden(t, "testdata/replay.golden.json", collector.Txs())
+}
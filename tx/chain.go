@@ -0,0 +1,110 @@
+package tx
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"github.com/key-inside/patrasche/deadletter"
+	"github.com/key-inside/patrasche/retry"
+)
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as tx handlers
+type HandlerFunc func(*Tx) error
+
+func (f HandlerFunc) Handle(tx *Tx) error {
+	return f(tx)
+}
+
+// Middleware wraps the next handler
+type Middleware func(next Handler) Handler
+
+// Chain builds a handler from the final handler and middlewares.
+// Transactions pass through the middlewares in the given order, so the first one is the outermost.
+func Chain(final Handler, mws ...Middleware) Handler {
+	h := final
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type tee struct {
+	handlers []Handler
+}
+
+// Tee hands the tx to all handlers in order and stops at the first error
+func Tee(handlers ...Handler) Handler {
+	return &tee{handlers: handlers}
+}
+
+func (t *tee) Handle(tx *Tx) error {
+	for _, h := range t.handlers {
+		if h == nil {
+			continue
+		}
+		if err := h.Handle(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type route struct {
+	predicate func(*Tx) bool
+	then      Handler
+	otherwise Handler
+}
+
+// Route hands the tx to 'then' if the predicate returns true, otherwise to 'otherwise'.
+// Both handlers can be nil.
+func Route(predicate func(*Tx) bool, then, otherwise Handler) Handler {
+	return &route{
+		predicate: predicate,
+		then:      then,
+		otherwise: otherwise,
+	}
+}
+
+func (r *route) Handle(tx *Tx) error {
+	h := r.otherwise
+	if r.predicate(tx) {
+		h = r.then
+	}
+	if h != nil {
+		return h.Handle(tx)
+	}
+	return nil
+}
+
+// middleware presets
+
+func StdLogger(logger *zerolog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return NewStdLogger(next, logger)
+	}
+}
+
+func HashFilter(pattern string, filteredActions ...Action) Middleware {
+	return func(next Handler) Handler {
+		return NewHashFilter(next, pattern, filteredActions...)
+	}
+}
+
+func ValidEndorserFilter(filteredActions ...Action) Middleware {
+	return func(next Handler) Handler {
+		return NewValidEndorserFilter(next, filteredActions...)
+	}
+}
+
+func Retry(ctx context.Context, policy *retry.Policy) Middleware {
+	return func(next Handler) Handler {
+		return NewRetryHandler(ctx, next, policy)
+	}
+}
+
+func DeadLetter(sink deadletter.Sink) Middleware {
+	return func(next Handler) Handler {
+		return NewDeadLetterHandler(next, sink)
+	}
+}
@@ -23,7 +23,10 @@ func NewHashFilter(next Handler, pattern string, filteredActions ...Action) Hand
 
 func (f *hashFilter) Handle(tx *Tx) error {
 	if f.hashPattern.MatchString(tx.ID()) {
-		return f.next.Handle(tx)
+		if f.next != nil {
+			return f.next.Handle(tx)
+		}
+		return nil
 	}
 	for _, action := range f.filteredActions {
 		if err := action(tx); err != nil {
@@ -57,7 +60,10 @@ func NewValidEndorserFilter(next Handler, filteredActions ...Action) Handler {
 
 func (f *validEndorserFilter) Handle(tx *Tx) error {
 	if tx.IsValid() && tx.HeaderType() == common.HeaderType_ENDORSER_TRANSACTION {
-		return f.next.Handle(tx)
+		if f.next != nil {
+			return f.next.Handle(tx)
+		}
+		return nil
 	}
 	for _, action := range f.filteredActions {
 		if err := action(tx); err != nil {
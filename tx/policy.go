@@ -0,0 +1,71 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/key-inside/patrasche/deadletter"
+	"github.com/key-inside/patrasche/retry"
+)
+
+type retryHandler struct {
+	ctx    context.Context
+	policy *retry.Policy
+	next   Handler
+}
+
+// NewRetryHandler retries the next handler by the policy.
+// Permanent errors and the last error after exhausting attempts are returned.
+// Waiting for the next attempt stops when ctx is done, ex) on shutdown.
+func NewRetryHandler(ctx context.Context, next Handler, policy *retry.Policy) Handler {
+	return &retryHandler{
+		ctx:    ctx,
+		policy: policy,
+		next:   next,
+	}
+}
+
+func (h *retryHandler) Handle(tx *Tx) error {
+	if h.next == nil {
+		return nil
+	}
+	return h.policy.Do(h.ctx, func() error {
+		return h.next.Handle(tx)
+	})
+}
+
+type deadLetterHandler struct {
+	sink deadletter.Sink
+	next Handler
+}
+
+// NewDeadLetterHandler skips the transaction that the next handler fails to handle
+// after recording it into the sink. Wrap a retry handler to skip after N attempts.
+func NewDeadLetterHandler(next Handler, sink deadletter.Sink) Handler {
+	return &deadLetterHandler{
+		sink: sink,
+		next: next,
+	}
+}
+
+func (h *deadLetterHandler) Handle(tx *Tx) error {
+	if h.next == nil {
+		return nil
+	}
+	err := h.next.Handle(tx)
+	if err == nil {
+		return nil
+	}
+	r := deadletter.Record{
+		BlockNum:       tx.BlockNum,
+		TxID:           tx.ID(),
+		Seq:            tx.Seq,
+		ValidationCode: int32(tx.ValidationCode),
+		Error:          err.Error(),
+		Envelope:       tx.Envelope,
+	}
+	if pErr := h.sink.Put(r); pErr != nil {
+		return fmt.Errorf("failed to put dead-letter (%v): %w", err, pErr)
+	}
+	return nil
+}
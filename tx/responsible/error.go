@@ -2,6 +2,7 @@ package responsible
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -35,3 +36,17 @@ func ToError(err error) (Error, error) {
 	}
 	return rErr, err
 }
+
+// From returns the responsible error in the error chain,
+// or parses the description of a chaincode error returned by fabric-sdk-go
+func From(err error) (Error, bool) {
+	if err == nil {
+		return Error{}, false
+	}
+	var rErr Error
+	if errors.As(err, &rErr) {
+		return rErr, true
+	}
+	rErr, pErr := ToError(err)
+	return rErr, pErr == nil && rErr.Code != ""
+}
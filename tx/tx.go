@@ -18,6 +18,7 @@ type Tx struct {
 	SignatureHeader *common.SignatureHeader
 	Transaction     *peer.Transaction
 	ValidationCode  peer.TxValidationCode
+	Envelope        []byte // raw envelope, nil if created by New
 }
 
 func New(blockNum uint64, seq int, validationByte byte, payloadData []byte) (*Tx, error) {
@@ -47,6 +48,20 @@ func New(blockNum uint64, seq int, validationByte byte, payloadData []byte) (*Tx
 	}, nil
 }
 
+// NewFromEnvelope returns a Tx keeping the raw envelope
+func NewFromEnvelope(blockNum uint64, seq int, validationByte byte, envelopeData []byte) (*Tx, error) {
+	envelope, err := proto.UnmarshalEnvelope(envelopeData)
+	if err != nil {
+		return nil, err
+	}
+	t, err := New(blockNum, seq, validationByte, envelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+	t.Envelope = envelopeData
+	return t, nil
+}
+
 // ID returns TxID(Tx Hash)
 func (t Tx) ID() string {
 	return t.Header.TxId
@@ -61,8 +76,10 @@ func (t Tx) IsValid() bool {
 }
 
 func (t Tx) Timestamp() *timestamp.Timestamp {
-	ts := timestamp.Timestamp(*t.Header.Timestamp)
-	return &ts
+	if t.Header.Timestamp == nil {
+		return &timestamp.Timestamp{}
+	}
+	return &timestamp.Timestamp{Seconds: t.Header.Timestamp.Seconds, Nanos: t.Header.Timestamp.Nanos}
 }
 
 func (t Tx) MSPID() string {